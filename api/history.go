@@ -0,0 +1,102 @@
+package api
+
+import (
+	"github.com/soheltarir/ekko/config"
+	"github.com/soheltarir/ekko/probe"
+	"sync"
+	"time"
+)
+
+// Record is the outcome of a single probe run of a server, as served by the API
+type Record struct {
+	Time        time.Time `json:"time"`
+	Protocol    string    `json:"protocol"`
+	Addr        string    `json:"addr,omitempty"`
+	PacketsSent int       `json:"packets_sent"`
+	PacketsRecv int       `json:"packets_recv"`
+	PacketLoss  float64   `json:"packet_loss"`
+	AvgRtt      float64   `json:"avg_rtt_ms"`
+	MinRtt      float64   `json:"min_rtt_ms"`
+	MaxRtt      float64   `json:"max_rtt_ms"`
+	Jitter      float64   `json:"jitter_ms"`
+	P50Rtt      float64   `json:"p50_rtt_ms"`
+	P90Rtt      float64   `json:"p90_rtt_ms"`
+	P99Rtt      float64   `json:"p99_rtt_ms"`
+	StdDevRtt   float64   `json:"stddev_rtt_ms"`
+	MOS         float64   `json:"mos"`
+	// Error is set when the probe failed to run, the statistics are empty then
+	Error string `json:"error,omitempty"`
+}
+
+// milliseconds converts a duration to fractional milliseconds
+func milliseconds(d time.Duration) float64 {
+	return float64(d) / float64(time.Millisecond)
+}
+
+// NewRecord converts the outcome of a probe run to a Record
+func NewRecord(server config.Server, result *probe.Result, err error) Record {
+	record := Record{Time: time.Now(), Protocol: server.Protocol}
+	if err != nil {
+		record.Error = err.Error()
+		return record
+	}
+	record.Addr = result.Addr
+	record.PacketsSent = result.PacketsSent
+	record.PacketsRecv = result.PacketsRecv
+	record.PacketLoss = result.PacketLoss
+	record.AvgRtt = milliseconds(result.AvgRtt)
+	record.MinRtt = milliseconds(result.MinRtt)
+	record.MaxRtt = milliseconds(result.MaxRtt)
+	record.Jitter = milliseconds(result.Jitter)
+	record.P50Rtt = milliseconds(result.P50Rtt)
+	record.P90Rtt = milliseconds(result.P90Rtt)
+	record.P99Rtt = milliseconds(result.P99Rtt)
+	record.StdDevRtt = milliseconds(result.StdDevRtt)
+	record.MOS = result.MOS
+	return record
+}
+
+// History keeps the most recent records of every server, keyed by the server name
+type History struct {
+	lock    sync.RWMutex
+	size    int
+	records map[string][]Record
+}
+
+// NewHistory returns a history keeping up to size records per server
+func NewHistory(size int) *History {
+	return &History{size: size, records: make(map[string][]Record)}
+}
+
+// Observe records the outcome of a probe run, it satisfies consumer.ResultHandler
+func (h *History) Observe(server config.Server, result *probe.Result, err error) {
+	h.lock.Lock()
+	defer h.lock.Unlock()
+	records := append(h.records[server.Name], NewRecord(server, result, err))
+	if len(records) > h.size {
+		records = records[len(records)-h.size:]
+	}
+	h.records[server.Name] = records
+}
+
+// Latest returns the most recent record of the server, if any
+func (h *History) Latest(name string) (Record, bool) {
+	h.lock.RLock()
+	defer h.lock.RUnlock()
+	records := h.records[name]
+	if len(records) == 0 {
+		return Record{}, false
+	}
+	return records[len(records)-1], true
+}
+
+// Recent returns up to limit of the most recent records of the server, the oldest first
+func (h *History) Recent(name string, limit int) []Record {
+	h.lock.RLock()
+	defer h.lock.RUnlock()
+	records := h.records[name]
+	if limit > 0 && len(records) > limit {
+		records = records[len(records)-limit:]
+	}
+	return append([]Record{}, records...)
+}
@@ -0,0 +1,217 @@
+// Package api serves the live state of Ekko over a local JSON HTTP API, for running it as a headless daemon
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"github.com/soheltarir/ekko/config"
+	"github.com/soheltarir/ekko/consumer"
+	"github.com/soheltarir/ekko/logger"
+	"go.uber.org/zap"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	// serversPath is the prefix of the server resources
+	serversPath = "/api/servers/"
+	// probeQueueTimeout bounds the wait for a worker to pick up an on-demand probe
+	probeQueueTimeout = 5 * time.Second
+)
+
+// Server serves the API over HTTP
+type Server struct {
+	history  *History
+	consumer *consumer.Consumer
+}
+
+// New returns an API server, serving the records of the history and the state of the consumer
+func New(history *History, pingConsumer *consumer.Consumer) *Server {
+	return &Server{history: history, consumer: pingConsumer}
+}
+
+// serverView is a configured server along with its latest record
+type serverView struct {
+	Name     string                 `json:"name"`
+	Address  string                 `json:"address"`
+	Protocol string                 `json:"protocol"`
+	Port     int                    `json:"port,omitempty"`
+	Group    string                 `json:"group,omitempty"`
+	Labels   map[string]interface{} `json:"labels,omitempty"`
+	Latest   *Record                `json:"latest"`
+}
+
+// statusView is the state of the consumer and its workers
+type statusView struct {
+	Status      config.ConsumerStatus `json:"status"`
+	Workers     int                   `json:"workers"`
+	BusyWorkers int                   `json:"busy_workers"`
+	QueueLength int                   `json:"queue_length"`
+}
+
+// errorView is the body of the error responses
+type errorView struct {
+	Error string `json:"error"`
+}
+
+func (s *Server) handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/api/servers", s.listServers)
+	mux.HandleFunc(serversPath, s.serverResource)
+	mux.HandleFunc("/api/status", s.status)
+	return mux
+}
+
+// Serve runs the API server until ctx is done
+func (s *Server) Serve(ctx context.Context) {
+	listen := config.Current().API.Listen
+	server := &http.Server{Addr: listen, Handler: s.handler()}
+
+	go func() {
+		<-ctx.Done()
+		logger.Log.Warn("Received termination signal, stopping API server")
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		if err := server.Shutdown(shutdownCtx); err != nil {
+			logger.Log.Warn("Failed to gracefully stop API server", zap.Error(err))
+		}
+	}()
+
+	logger.Log.Info("API server started", zap.String("listen", listen))
+	if err := server.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+		logger.Log.Error("API server failed", zap.Error(err))
+	}
+}
+
+func writeJSON(w http.ResponseWriter, status int, body interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(body); err != nil {
+		logger.Log.Warn("Failed to write API response", zap.Error(err))
+	}
+}
+
+func writeError(w http.ResponseWriter, status int, message string) {
+	writeJSON(w, status, errorView{Error: message})
+}
+
+// findServer returns the configured server with the name
+func findServer(name string) (config.Server, bool) {
+	for _, server := range config.Current().Servers {
+		if server.Name == name {
+			return server, true
+		}
+	}
+	return config.Server{}, false
+}
+
+// listServers handles GET /api/servers
+func (s *Server) listServers(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		writeError(w, http.StatusMethodNotAllowed, "method not allowed")
+		return
+	}
+	servers := config.Current().Servers
+	views := make([]serverView, 0, len(servers))
+	for _, server := range servers {
+		view := serverView{
+			Name:     server.Name,
+			Address:  server.Address,
+			Protocol: server.Protocol,
+			Port:     server.Port,
+			Group:    server.Group,
+			Labels:   server.Labels,
+		}
+		if latest, ok := s.history.Latest(server.Name); ok {
+			view.Latest = &latest
+		}
+		views = append(views, view)
+	}
+	writeJSON(w, http.StatusOK, views)
+}
+
+// serverResource handles GET /api/servers/{name}/history and POST /api/servers/{name}/probe
+func (s *Server) serverResource(w http.ResponseWriter, r *http.Request) {
+	path := strings.TrimPrefix(r.URL.EscapedPath(), serversPath)
+	idx := strings.LastIndex(path, "/")
+	if idx < 0 {
+		writeError(w, http.StatusNotFound, "not found")
+		return
+	}
+	name, err := url.PathUnescape(path[:idx])
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "invalid server name")
+		return
+	}
+	server, ok := findServer(name)
+	if !ok {
+		writeError(w, http.StatusNotFound, "server not found")
+		return
+	}
+
+	switch action := path[idx+1:]; {
+	case action == "history" && r.Method == http.MethodGet:
+		s.serverHistory(w, r, server)
+	case action == "probe" && r.Method == http.MethodPost:
+		s.probeServer(w, r, server)
+	case action == "history" || action == "probe":
+		writeError(w, http.StatusMethodNotAllowed, "method not allowed")
+	default:
+		writeError(w, http.StatusNotFound, "not found")
+	}
+}
+
+// serverHistory returns the recent records of the server, limited by the limit query parameter
+func (s *Server) serverHistory(w http.ResponseWriter, r *http.Request, server config.Server) {
+	limit := 0
+	if value := r.URL.Query().Get("limit"); value != "" {
+		parsed, err := strconv.Atoi(value)
+		if err != nil || parsed < 0 {
+			writeError(w, http.StatusBadRequest, "limit must be a positive integer")
+			return
+		}
+		limit = parsed
+	}
+	writeJSON(w, http.StatusOK, s.history.Recent(server.Name, limit))
+}
+
+// probeServer sends an event for the server to the consumer, out of the producer's schedule
+func (s *Server) probeServer(w http.ResponseWriter, r *http.Request, server config.Server) {
+	if s.consumer.Status() != config.Running {
+		writeError(w, http.StatusServiceUnavailable, "consumer is not running")
+		return
+	}
+	event := consumer.NewEvent(server)
+	event.OutOfBand = true
+	logger.Log.Debug("Sending out-of-band event", zap.Any("event", event))
+	// The callback blocks until a worker is free, don't hold the request for longer than probeQueueTimeout
+	ctx, cancel := context.WithTimeout(r.Context(), probeQueueTimeout)
+	defer cancel()
+	if err := s.consumer.CallbackFunc(ctx, event); err != nil {
+		if errors.Is(err, consumer.ErrStopped) {
+			writeError(w, http.StatusServiceUnavailable, err.Error())
+		} else {
+			writeError(w, http.StatusServiceUnavailable, "every worker is busy, try again later")
+		}
+		return
+	}
+	writeJSON(w, http.StatusAccepted, map[string]string{"event_id": event.ID.String()})
+}
+
+// status handles GET /api/status
+func (s *Server) status(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		writeError(w, http.StatusMethodNotAllowed, "method not allowed")
+		return
+	}
+	writeJSON(w, http.StatusOK, statusView{
+		Status:      s.consumer.Status(),
+		Workers:     s.consumer.Workers(),
+		BusyWorkers: s.consumer.BusyWorkers(),
+		QueueLength: s.consumer.QueueLength(),
+	})
+}
@@ -0,0 +1,93 @@
+package main
+
+import (
+	"fmt"
+	"github.com/soheltarir/ekko/config"
+	"github.com/soheltarir/ekko/logger"
+	"github.com/soheltarir/ekko/probe"
+	"github.com/spf13/cobra"
+	"go.uber.org/zap"
+)
+
+// newRootCommand returns the command line of Ekko, the servers are monitored when no subcommand is given
+func newRootCommand() *cobra.Command {
+	root := &cobra.Command{
+		Use:   "ekko [targets...]",
+		Short: "Ekko monitors the latency & packet loss towards your servers",
+		Long: "Ekko monitors the latency & packet loss towards your servers.\n\n" +
+			"Every setting of the configuration file can be overridden with an environment variable prefixed\n" +
+			"with " + config.EnvPrefix + "_, e.g. " + config.EnvPrefix + "_WORKER_POOL_SIZE=10 or " +
+			config.EnvPrefix + "_LOGGING_FILE_ENABLED=true.",
+		Args: cobra.ArbitraryArgs,
+		RunE: run,
+		// The errors are reported by main, as the configuration problems are listed in their own format
+		SilenceErrors: true,
+		SilenceUsage:  true,
+	}
+
+	var configFile string
+	flags := root.PersistentFlags()
+	flags.StringVarP(&configFile, "config", "c", "", "path of the configuration file (default config.yaml in . or /etc/ekko)")
+	flags.Bool("ui", false, "render the live statistics table, overrides ui_enabled")
+	flags.Int64("interval", 0, "seconds between two probe runs, overrides ping_interval")
+	flags.Int("workers", 0, "number of servers probed concurrently, overrides worker_pool_size")
+	flags.String("log-dir", "", "directory of the file logs, overrides logging.file_logs_dir")
+	flags.String("source", "", "interface name or IP address the probes are sent from, overrides source")
+	flags.StringP("selector", "l", "", "only run the servers whose labels match, e.g. provider=Riot,region!=eu, overrides selector")
+	flags.StringSliceP("group", "g", nil, "only run the servers of the groups, can be repeated, overrides run_groups")
+	config.BindFlag("ui_enabled", flags.Lookup("ui"))
+	config.BindFlag("ping_interval", flags.Lookup("interval"))
+	config.BindFlag("worker_pool_size", flags.Lookup("workers"))
+	config.BindFlag("logging.file_logs_dir", flags.Lookup("log-dir"))
+	config.BindFlag("source", flags.Lookup("source"))
+	config.BindFlag("selector", flags.Lookup("selector"))
+	config.BindFlag("run_groups", flags.Lookup("group"))
+	root.PersistentPreRun = func(cmd *cobra.Command, args []string) {
+		config.SetFile(configFile)
+	}
+
+	root.AddCommand(
+		&cobra.Command{
+			Use:   "run [targets...]",
+			Short: "Monitor the servers until interrupted, the targets given replace the configured servers",
+			Args:  cobra.ArbitraryArgs,
+			RunE:  run,
+		},
+		&cobra.Command{
+			Use:   "validate",
+			Short: "Check the configuration, listing every problem found in it",
+			Args:  cobra.NoArgs,
+			RunE:  validate,
+		},
+		newOnceCommand(),
+		newReportCommand(),
+	)
+	return root
+}
+
+// exitStatus is returned by the commands which complete, yet must exit with a non-zero status
+type exitStatus int
+
+func (s exitStatus) Error() string {
+	return fmt.Sprintf("exit status %d", int(s))
+}
+
+// loadConfig loads the configuration, with the targets given replacing the configured servers,
+// and sets up the logger as per it
+func loadConfig(targets []string) error {
+	config.SetTargets(targets)
+	if err := config.Load(); err != nil {
+		return err
+	}
+	logger.Setup()
+	return nil
+}
+
+// logICMPMode logs the mode the ICMP sockets are opened in, warning when they can't be opened in it
+func logICMPMode() {
+	mode := probe.ICMPMode()
+	logger.Log.Info("ICMP mode selected", zap.String("mode", mode), zap.String("icmp_privilege", config.Current().ICMPPrivilege))
+	if err := probe.CheckICMPMode(mode); err != nil {
+		logger.Log.Warn("ICMP sockets can't be opened, the ICMP probes will fail", zap.String("mode", mode), zap.Error(err))
+	}
+}
@@ -1,16 +1,177 @@
 package config
 
 import (
+	"errors"
+	"fmt"
+	"github.com/fsnotify/fsnotify"
 	"github.com/mcuadros/go-defaults"
+	"github.com/mitchellh/mapstructure"
 	"github.com/spf13/viper"
-	"log"
+	"reflect"
+	"strings"
+	"sync/atomic"
+	"time"
 )
 
 // Server defines the object of a Game server
 type Server struct {
 	Name    string `mapstructure:"name"`
 	Address string `mapstructure:"address"`
-	Labels  map[string]interface{}
+	// Protocol selects the prober used to measure the server, see the probe package
+	Protocol string `mapstructure:"protocol" default:"icmp"`
+	// Port is the destination port, required by the protocols working on top of TCP/UDP
+	Port int `mapstructure:"port"`
+	// IPFamily restricts the addresses the server is probed on to either v4 or v6, whereas both probes the
+	// server on each of them as two servers. The first address resolved is probed when omitted.
+	IPFamily string `mapstructure:"ip_family"`
+	// UDP configures the datagrams sent when the protocol is udp
+	UDP UDPOptions `mapstructure:"udp"`
+	// HTTP configures the requests sent when the protocol is http, the address is then the URL to request
+	HTTP HTTPOptions `mapstructure:"http"`
+	// DNS configures the queries sent when the protocol is dns, the address is then the resolver to query
+	DNS DNSOptions `mapstructure:"dns"`
+	// Trace configures the path analysis when the protocol is trace
+	Trace TraceOptions `mapstructure:"trace"`
+	// PMTU configures the path MTU discovery when the protocol is pmtu
+	PMTU PMTUOptions `mapstructure:"pmtu"`
+	// PacketCount sends a fixed number of packets in every run, instead of a random number between
+	// MinPacketNum & MaxPacketNum
+	PacketCount int `mapstructure:"packet_count"`
+	// MinPacketNum, MaxPacketNum, PingTimeout & PingInterval override the global settings for the server,
+	// they are set to the global ones when omitted
+	MinPacketNum int   `mapstructure:"min_packet_num"`
+	MaxPacketNum int   `mapstructure:"max_packet_num"`
+	PingTimeout  int64 `mapstructure:"ping_timeout"`  // in seconds
+	PingInterval int64 `mapstructure:"ping_interval"` // in seconds
+	// PacketSize is the size of the payload of the ICMP echo requests & UDP datagrams in bytes, the UDP payloads
+	// being padded up to it
+	PacketSize int `mapstructure:"packet_size"`
+	// TTL is the time to live of the packets sent, the system default is used when omitted
+	TTL int `mapstructure:"ttl"`
+	// DSCP is the class the packets sent are marked with, either a name e.g. EF or AF41, or a number up to 63,
+	// it defaults to the global one
+	DSCP string `mapstructure:"dscp"`
+	// DontFragment sets the DF bit of the packets sent, so that the packets exceeding the MTU of the path are
+	// dropped rather than fragmented, it defaults to the global one
+	DontFragment *bool `mapstructure:"dont_fragment"`
+	// Source is the interface name, or the IP address the probes are sent from, it defaults to the global one
+	Source string `mapstructure:"source"`
+	// Schedule replaces the PingInterval of the server with a cron expression, and/or restricts its runs to time windows
+	Schedule ScheduleOptions `mapstructure:"schedule"`
+	// Discover turns the server into a generator of the servers discovered from its address, see DiscoverOptions
+	Discover DiscoverOptions `mapstructure:"discover"`
+	Labels   map[string]interface{}
+	// DiscoveredBy is the name of the generator which discovered the server, it is empty for the declared ones
+	DiscoveredBy string `mapstructure:"-"`
+	// Group is the name of the first group selecting the server, it is set once the configuration is loaded
+	Group string `mapstructure:"-"`
+	// File is the path of the included file the server is declared in, empty for the configuration file
+	File string `mapstructure:"-"`
+	// path is the path of the declared server, or of the generator the server was discovered by, e.g. servers[2]
+	path string
+}
+
+// Fragmentable reports whether the packets sent to the server may be fragmented, i.e. the DF bit isn't set
+func (s Server) Fragmentable() bool {
+	return s.DontFragment == nil || !*s.DontFragment
+}
+
+// Scheduled reports whether the server runs on a schedule, rather than on its interval only
+func (s Server) Scheduled() bool {
+	return s.Schedule.Cron != "" || len(s.Schedule.Windows) > 0
+}
+
+// Timeout returns the duration after which a probe run of the server is considered as failed
+func (s Server) Timeout() time.Duration {
+	return time.Duration(s.PingTimeout) * time.Second
+}
+
+// Interval returns the duration between the start of two consecutive probe runs of the server
+func (s Server) Interval() time.Duration {
+	return time.Duration(s.PingInterval) * time.Second
+}
+
+// Group gathers the servers selected by its selector under a section of the table
+type Group struct {
+	Name string `mapstructure:"name"`
+	// Selector is the expression selecting the servers of the group by their labels, see ParseSelector
+	Selector string `mapstructure:"selector"`
+	// Collapsed hides the rows of the servers of the group, only its aggregate row is shown then
+	Collapsed bool `mapstructure:"collapsed"`
+}
+
+// DiscoverOptions defines how the servers are discovered from the address of a generator server, each
+// discovered server inheriting the settings & the labels of the generator
+type DiscoverOptions struct {
+	// Mode is srv for the targets of a DNS SRV record, dns for every IP address a name resolves to, cidr for
+	// every host of a range, or pattern for the numeric ranges of a name, e.g. sgp-[1-4].valve.net
+	Mode string `mapstructure:"mode"`
+	// Refresh is the interval at which the srv & dns generators are resolved again
+	Refresh int64 `mapstructure:"refresh" default:"300"` // in seconds
+	// Limit is the maximum number of servers discovered
+	Limit int `mapstructure:"limit" default:"64"`
+}
+
+// ScheduleOptions defines when a server is probed
+type ScheduleOptions struct {
+	// Cron is a standard cron expression, e.g. */5 * * * *, which the server runs on instead of its interval
+	Cron string `mapstructure:"cron"`
+	// Timezone of the cron expression & the windows, e.g. Europe/Paris, the local one when omitted
+	Timezone string `mapstructure:"timezone"`
+	// Windows restrict the runs of the server to the periods they cover, when any
+	Windows []TimeWindow `mapstructure:"windows"`
+}
+
+// TimeWindow is a daily period, from & to being times of the day formatted as 15:04. The window spans
+// over midnight when to is earlier than from.
+type TimeWindow struct {
+	// Days are the week days the window starts on, e.g. mon, tue, every day when omitted
+	Days []string `mapstructure:"days"`
+	From string   `mapstructure:"from"`
+	To   string   `mapstructure:"to"`
+}
+
+// UDPOptions defines the payload sent on each attempt of a UDP probe
+type UDPOptions struct {
+	// Payload is a text/template rendered for every attempt, {{.Seq}} & {{.Timestamp}} are available in it
+	Payload string `mapstructure:"payload" default:"ekko {{.Seq}}"`
+	// PayloadFormat is either text, or hex when the rendered payload is hex encoded
+	PayloadFormat string `mapstructure:"payload_format" default:"text"`
+}
+
+// HTTPOptions defines the request sent, and the assertions made on the response of an HTTP probe
+type HTTPOptions struct {
+	Method  string            `mapstructure:"method" default:"GET"`
+	Headers map[string]string `mapstructure:"headers"`
+	// ExpectedStatus lists the status codes considered successful, any status below 400 is expected when empty
+	ExpectedStatus []int `mapstructure:"expected_status"`
+	// BodyContains is a substring which the response body must contain
+	BodyContains       string `mapstructure:"body_contains"`
+	InsecureSkipVerify bool   `mapstructure:"insecure_skip_verify"`
+}
+
+// DNSOptions defines the question asked to the resolver by a DNS probe
+type DNSOptions struct {
+	// Name is the domain name to query
+	Name string `mapstructure:"name"`
+	// Type is the record type to query, e.g. A, AAAA, MX
+	Type string `mapstructure:"type" default:"A"`
+	// Transport is either udp or tcp
+	Transport string `mapstructure:"transport" default:"udp"`
+}
+
+// PMTUOptions bounds the search of the path MTU discovery, which looks for the largest packet reaching the
+// destination with the DF bit set
+type PMTUOptions struct {
+	// MaxMTU is the largest MTU tried, in bytes including the IP header, e.g. 9000 for the paths of jumbo frames
+	MaxMTU int `mapstructure:"max_mtu" default:"1500"`
+}
+
+// TraceOptions defines the probes sent by a trace, to discover the hops on the path towards the destination
+type TraceOptions struct {
+	// Method is the kind of TTL limited probes sent, either icmp or udp
+	Method  string `mapstructure:"method" default:"icmp"`
+	MaxHops int    `mapstructure:"max_hops" default:"30"`
 }
 
 type loggingConfig struct {
@@ -19,41 +180,317 @@ type loggingConfig struct {
 	FileLogsDirectory string `mapstructure:"file_logs_dir"`
 }
 
+// metricsConfig defines the HTTP listener exposing the Prometheus metrics
+type metricsConfig struct {
+	Enabled bool   `mapstructure:"enabled"`
+	Listen  string `mapstructure:"listen" default:":9123"`
+	Path    string `mapstructure:"path" default:"/metrics"`
+}
+
+// apiConfig defines the HTTP listener serving the JSON API
+type apiConfig struct {
+	Enabled bool   `mapstructure:"enabled"`
+	Listen  string `mapstructure:"listen" default:"127.0.0.1:8123"`
+	// HistorySize is the number of recent results kept for each server
+	HistorySize int `mapstructure:"history_size" default:"100"`
+}
+
+type rttThresholds struct {
+	Warn  int64 `mapstructure:"warn" default:"100"`  // in milliseconds
+	Error int64 `mapstructure:"error" default:"200"` // in milliseconds
+}
+
+type lossThresholds struct {
+	Warn  float64 `mapstructure:"warn" default:"5"`   // in percent
+	Error float64 `mapstructure:"error" default:"10"` // in percent
+}
+
+// mosThresholds are lower bounds, as a higher Mean Opinion Score is better
+type mosThresholds struct {
+	Warn  float64 `mapstructure:"warn" default:"4"`
+	Error float64 `mapstructure:"error" default:"3.6"`
+}
+
+// thresholdsConfig defines the values above (or below) which the statistics are highlighted as warnings or errors
+type thresholdsConfig struct {
+	Rtt  rttThresholds  `mapstructure:"rtt"`
+	Loss lossThresholds `mapstructure:"loss"`
+	MOS  mosThresholds  `mapstructure:"mos"`
+}
+
 type config struct {
-	Servers        []Server `mapstructure:"servers"`
-	Logging        loggingConfig
-	MaxPacketNum   int   `mapstructure:"max_packet_num" default:"20"`
-	MinPacketNum   int   `mapstructure:"min_packet_num" default:"4"`
-	PingTimeout    int64 `mapstructure:"ping_timeout" default:"30"`  // in seconds
-	PingInterval   int64 `mapstructure:"ping_interval" default:"30"` // in seconds
-	WorkerPoolSize int   `mapstructure:"worker_pool_size" default:"5"`
-	UIEnabled      bool  `mapstructure:"ui_enabled" default:"true"`
+	Servers []Server `mapstructure:"servers"`
+	// Include lists the paths or globs of the files whose servers are appended to Servers, relative to the
+	// directory of the configuration file
+	Include []string `mapstructure:"include"`
+	// declared are the servers as declared, whereas Servers lists the selected ones, the generators being
+	// replaced with the servers they discovered
+	declared []Server
+	// Groups are matched in order, a server is part of the first group selecting it
+	Groups []Group `mapstructure:"groups"`
+	// Selector & RunGroups restrict the servers run to the ones selected by the selector, and part of the groups
+	Selector     string   `mapstructure:"selector"`
+	RunGroups    []string `mapstructure:"run_groups"`
+	Logging      loggingConfig
+	Thresholds   thresholdsConfig `mapstructure:"thresholds"`
+	Metrics      metricsConfig    `mapstructure:"metrics"`
+	API          apiConfig        `mapstructure:"api"`
+	MaxPacketNum int              `mapstructure:"max_packet_num" default:"20"`
+	MinPacketNum int              `mapstructure:"min_packet_num" default:"4"`
+	PingTimeout  int64            `mapstructure:"ping_timeout" default:"30"`  // in seconds
+	PingInterval int64            `mapstructure:"ping_interval" default:"30"` // in seconds
+	// PingJitter is the maximum random delay of the first run of each server, spreading their runs over time
+	PingJitter int64 `mapstructure:"ping_jitter" default:"5"` // in seconds
+	// PacketSize, TTL, DSCP & DontFragment are the defaults of the settings of the servers
+	PacketSize   int    `mapstructure:"packet_size"`
+	TTL          int    `mapstructure:"ttl"`
+	DSCP         string `mapstructure:"dscp"`
+	DontFragment bool   `mapstructure:"dont_fragment"`
+	// Source is the interface name, or the IP address the probes of every server are sent from by default
+	Source         string `mapstructure:"source"`
+	WorkerPoolSize int    `mapstructure:"worker_pool_size" default:"5"`
+	// ICMPPrivilege selects whether the ICMP sockets are raw (privileged), datagram ones (unprivileged), or
+	// detected as per the privileges of the process (auto)
+	ICMPPrivilege string `mapstructure:"icmp_privilege" default:"auto"`
+	UIEnabled     bool   `mapstructure:"ui_enabled" default:"true"`
+}
+
+// current holds the *config in use, it is replaced on reloads & discoveries while being read concurrently
+var current atomic.Value
+
+// Current returns the configuration in use. It gets replaced rather than modified, hence must not be modified
+// either; a value held throughout an operation stays consistent.
+func Current() *config {
+	c, _ := current.Load().(*config)
+	return c
 }
 
-var Config *config
 var FileLogPath string
 
-func initialiseViper() {
-	viper.SetConfigName("config")
-	viper.SetConfigType("yaml")
-	viper.AddConfigPath(".")
-	viper.AddConfigPath("/etc/ekko")
+func initialiseViper() error {
+	if overrides.file != "" {
+		viper.SetConfigFile(overrides.file)
+	} else {
+		viper.SetConfigName("config")
+		viper.SetConfigType("yaml")
+		viper.AddConfigPath(".")
+		viper.AddConfigPath("/etc/ekko")
+	}
+	if err := applyOverrides(viper.GetViper()); err != nil {
+		return err
+	}
 	if err := viper.ReadInConfig(); err != nil {
-		log.Panicf("Error reading config file: %s\n", err)
+		// The defaults are enough to probe the targets given on the command line
+		var notFound viper.ConfigFileNotFoundError
+		if errors.As(err, &notFound) && len(overrides.targets) > 0 {
+			return nil
+		}
+		return fmt.Errorf("error reading config file: %w", err)
 	}
+	return nil
 }
 
 func setupLogDirectory() {
 
 }
 
-func init() {
-	initialiseViper()
-	if err := viper.Unmarshal(&Config); err != nil {
-		log.Panicf("Invalid configuration, %s", err)
+// load parses & validates the configuration read by v
+func load(v *viper.Viper) (*config, error) {
+	// Set the defaults before unmarshalling, so that they don't override the values explicitly set to false/zero
+	loaded := new(config)
+	defaults.SetDefaults(loaded)
+	var invalid ValidationError
+	if err := v.Unmarshal(loaded); err != nil {
+		// Report every field which couldn't be decoded, and carry on validating the rest of them
+		var decodeErr *mapstructure.Error
+		if !errors.As(err, &decodeErr) {
+			return nil, fmt.Errorf("invalid configuration, %w", err)
+		}
+		for _, msg := range decodeErr.Errors {
+			invalid = append(invalid, Problem{Message: msg})
+		}
+	}
+	if file := v.ConfigFileUsed(); file != "" {
+		invalid = append(invalid, loaded.include(file)...)
+	}
+	applyTargets(loaded)
+	for i := range loaded.Servers {
+		defaults.SetDefaults(&loaded.Servers[i])
+		loaded.inherit(&loaded.Servers[i])
+	}
+	invalid = append(invalid, loaded.validate()...)
+	if len(invalid) > 0 {
+		return nil, invalid
+	}
+	// The servers of the generators which failed to be resolved are missing, the failures are only reported
+	// when no server is left though, as the generators are resolved again periodically
+	failed := loaded.discover()
+	if len(loaded.Servers) == 0 {
+		if len(failed) > 0 {
+			return nil, ValidationError(failed)
+		}
+		return nil, ValidationError{{Field: "selector", Message: "none of the servers is selected"}}
+	}
+	if invalid := loaded.discovered(); len(invalid) > 0 {
+		return nil, invalid
+	}
+	return loaded, nil
+}
+
+// inherit sets the probe settings which aren't overridden by server to the global ones
+func (c *config) inherit(server *Server) {
+	if server.PacketCount > 0 {
+		server.MinPacketNum, server.MaxPacketNum = server.PacketCount, server.PacketCount
+	}
+	if server.MinPacketNum == 0 {
+		server.MinPacketNum = c.MinPacketNum
 	}
-	defaults.SetDefaults(Config)
-	if viper.GetBool("logging.console_enabled") && viper.GetBool("ui_enabled") {
-		log.Panicf("Both logging.console_enabled & ui_enabled can't be enabled simultaneously")
+	if server.MaxPacketNum == 0 {
+		server.MaxPacketNum = c.MaxPacketNum
 	}
+	if server.PingTimeout == 0 {
+		server.PingTimeout = c.PingTimeout
+	}
+	if server.PingInterval == 0 {
+		server.PingInterval = c.PingInterval
+	}
+	if server.Source == "" {
+		server.Source = c.Source
+	}
+	if server.PacketSize == 0 {
+		server.PacketSize = c.PacketSize
+	}
+	if server.TTL == 0 {
+		server.TTL = c.TTL
+	}
+	if server.DSCP == "" {
+		server.DSCP = c.DSCP
+	}
+	if server.DontFragment == nil {
+		dontFragment := c.DontFragment
+		server.DontFragment = &dontFragment
+	}
+}
+
+// RestartRequired lists the settings changed on reload which only apply once Ekko restarts, their previous
+// values are kept running meanwhile
+type RestartRequired []string
+
+func (r RestartRequired) Error() string {
+	return fmt.Sprintf("%s changed, which requires a restart", strings.Join(r, ", "))
+}
+
+// keepRestartOnly sets the settings of reloaded which only apply on restart back to the ones running, and
+// returns the ones which changed
+func keepRestartOnly(running, reloaded *config) RestartRequired {
+	var changed RestartRequired
+	if reloaded.UIEnabled != running.UIEnabled {
+		changed = append(changed, "ui_enabled")
+		reloaded.UIEnabled = running.UIEnabled
+	}
+	if !reflect.DeepEqual(reloaded.Logging, running.Logging) {
+		changed = append(changed, "logging")
+		reloaded.Logging = running.Logging
+	}
+	if !reflect.DeepEqual(reloaded.Metrics, running.Metrics) {
+		changed = append(changed, "metrics")
+		reloaded.Metrics = running.Metrics
+	}
+	if !reflect.DeepEqual(reloaded.API, running.API) {
+		changed = append(changed, "api")
+		reloaded.API = running.API
+	}
+	if reloaded.ICMPPrivilege != running.ICMPPrivilege {
+		changed = append(changed, "icmp_privilege")
+		reloaded.ICMPPrivilege = running.ICMPPrivilege
+	}
+	return changed
+}
+
+// Watch reloads the configuration whenever its file, or any of the files it includes, changes. The files
+// added afterwards which match the include patterns are picked up too. onReload is called once the
+// reloaded configuration is applied, whereas onError is called when it is invalid, in which case the
+// previous configuration is kept running. The settings requiring a restart keep their previous values, onError
+// being called with a RestartRequired error listing them. The returned function stops watching, once it returns onReload
+// and onError are no longer called.
+func Watch(onReload func(), onError func(err error)) (stop func()) {
+	file := viper.ConfigFileUsed()
+	if file == "" {
+		// Only the targets given on the command line are probed
+		return func() {}
+	}
+	includes, err := newIncludeWatcher(file)
+	if err != nil {
+		onError(err)
+	}
+	// viper can't stop watching, hence its changes are ignored once stopped
+	stopped := false
+	reload := func() {
+		// The configuration file & the included ones are watched separately, hence may change concurrently
+		reloading.Lock()
+		defer reloading.Unlock()
+		if stopped {
+			return
+		}
+		// Read the file afresh, as viper keeps its previous state if the file can't be parsed
+		v := viper.New()
+		v.SetConfigFile(file)
+		if err := applyOverrides(v); err != nil {
+			onError(err)
+			return
+		}
+		if err := v.ReadInConfig(); err != nil {
+			onError(err)
+			return
+		}
+		reloaded, err := load(v)
+		if err != nil {
+			onError(err)
+			return
+		}
+		if changed := keepRestartOnly(Current(), reloaded); len(changed) > 0 {
+			onError(changed)
+		}
+		current.Store(reloaded)
+		if includes != nil {
+			if err := includes.sync(); err != nil {
+				onError(err)
+			}
+		}
+		onReload()
+	}
+	viper.OnConfigChange(func(fsnotify.Event) {
+		reload()
+	})
+	viper.WatchConfig()
+	if includes != nil {
+		go includes.run(reload)
+	}
+	return func() {
+		reloading.Lock()
+		defer reloading.Unlock()
+		stopped = true
+		if includes != nil {
+			includes.watcher.Close()
+		}
+	}
+}
+
+// Load reads the configuration file, from either the working directory or /etc/ekko unless set with
+// SetFile, and applies it along with the overrides, see Current. A ValidationError listing all the problems is returned when it is invalid.
+func Load() error {
+	if err := initialiseViper(); err != nil {
+		return err
+	}
+	loaded, err := load(viper.GetViper())
+	if err != nil {
+		return err
+	}
+	current.Store(loaded)
+	return nil
+}
+
+// File returns the path of the configuration file in use
+func File() string {
+	return viper.ConfigFileUsed()
 }
@@ -0,0 +1,114 @@
+package config
+
+import (
+	"reflect"
+	"strings"
+	"sync"
+)
+
+// Discoverer returns the servers discovered by the generator server, along with the error it failed to be
+// resolved with, if any
+type Discoverer func(generator Server) ([]Server, error)
+
+var (
+	discoverer Discoverer
+	// unresolved keeps the generators looking up their servers as declared, see SkipDiscovery
+	unresolved bool
+	// reloading serialises the replacements of the configuration, on reload and on discovery
+	reloading sync.Mutex
+)
+
+// SetDiscoverer sets the function expanding the generator servers, which are dropped until one is set
+func SetDiscoverer(d Discoverer) {
+	discoverer = d
+}
+
+// SkipDiscovery keeps the generator servers looking up their servers as they are declared instead of
+// expanding them, so that the configuration is checked without any lookup. They are counted as a server each then.
+func SkipDiscovery() {
+	unresolved = true
+}
+
+// Generates reports whether the server is a generator of discovered servers, rather than a server to probe
+func (s Server) Generates() bool {
+	return s.Discover.Mode != ""
+}
+
+// LooksUp reports whether the generator looks its servers up in the DNS, rather than expanding its address
+func (s Server) LooksUp() bool {
+	mode := strings.ToLower(s.Discover.Mode)
+	return mode == "srv" || mode == "dns"
+}
+
+// DiscoversPort reports whether the servers discovered by the generator are probed on the port of their
+// target, rather than on the port of the generator
+func (s Server) DiscoversPort() bool {
+	return strings.EqualFold(s.Discover.Mode, "srv")
+}
+
+// Declared returns the servers of the configuration as declared, including the generators and the
+// servers which aren't selected
+func (c *config) Declared() []Server {
+	return c.declared
+}
+
+// discover replaces the generators with the servers they discover, the servers discovered with the name of
+// another server being dropped, and splits the servers probed over both IP families. The groups are then
+// assigned, and the servers selected. The generators which failed to be resolved are returned as problems.
+func (c *config) discover() []Problem {
+	if c.declared == nil {
+		c.declared = c.Servers
+	}
+	names := make(map[string]bool)
+	for _, server := range c.declared {
+		names[server.Name] = true
+	}
+	var failed problems
+	paths := serverPaths(c.declared)
+	servers := make([]Server, 0, len(c.declared))
+	for i, server := range c.declared {
+		// The discovered servers, and the ones split over both IP families, are copied from server
+		server.path = paths[i]
+		if !server.Generates() || (unresolved && server.LooksUp()) {
+			servers = append(servers, server)
+			continue
+		}
+		if discoverer == nil {
+			continue
+		}
+		discovered, err := discoverer(server)
+		if err != nil {
+			failed.add(paths[i]+".address", "failed to discover servers, %s", err)
+		}
+		for _, discovered := range discovered {
+			if names[discovered.Name] {
+				continue
+			}
+			names[discovered.Name] = true
+			servers = append(servers, discovered)
+		}
+	}
+	c.Servers = splitFamilies(servers)
+	c.assignGroups()
+	c.selectServers()
+	return failed
+}
+
+// Rediscover expands the generators of the configuration afresh, and reports whether the servers changed, in
+// which case the configuration is replaced. The servers discovered colliding with the others are returned as a
+// ValidationError, the previous servers being kept then.
+func Rediscover() (bool, error) {
+	reloading.Lock()
+	defer reloading.Unlock()
+	previous := Current()
+	rediscovered := *previous
+	rediscovered.discover()
+	if reflect.DeepEqual(rediscovered.Servers, previous.Servers) {
+		return false, nil
+	}
+	if invalid := rediscovered.discovered(); len(invalid) > 0 {
+		return false, invalid
+	}
+	current.Store(&rediscovered)
+	return true, nil
+}
@@ -0,0 +1,41 @@
+package config
+
+import (
+	"fmt"
+	"net"
+)
+
+// The IP families of Server.IPFamily
+const (
+	IPv4 = "v4"
+	IPv6 = "v6"
+	// BothIPs probes the server over IPv4 & IPv6, as two servers
+	BothIPs = "both"
+)
+
+// splitFamilies replaces every server probed over both IP families with a server per family, named after the
+// server and the family, e.g. Mumbai (IPv6). The servers whose address is an IP are probed over its family only.
+func splitFamilies(servers []Server) []Server {
+	split := make([]Server, 0, len(servers))
+	for _, server := range servers {
+		if server.IPFamily != BothIPs {
+			split = append(split, server)
+			continue
+		}
+		if ip := net.ParseIP(server.Address); ip != nil {
+			server.IPFamily = IPv6
+			if ip.To4() != nil {
+				server.IPFamily = IPv4
+			}
+			split = append(split, server)
+			continue
+		}
+		for _, family := range []struct{ name, version string }{{IPv4, "IPv4"}, {IPv6, "IPv6"}} {
+			probed := server
+			probed.Name = fmt.Sprintf("%s (%s)", server.Name, family.version)
+			probed.IPFamily = family.name
+			split = append(split, probed)
+		}
+	}
+	return split
+}
@@ -0,0 +1,185 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"github.com/fsnotify/fsnotify"
+	"github.com/mitchellh/mapstructure"
+	"github.com/spf13/viper"
+	"os"
+	"path/filepath"
+	"sort"
+)
+
+// included are the settings read from the files included by the configuration
+type included struct {
+	Servers []Server `mapstructure:"servers"`
+}
+
+// includePatterns returns the include patterns of c, the relative ones being resolved against the directory of
+// the configuration file
+func (c *config) includePatterns(file string) []string {
+	patterns := make([]string, len(c.Include))
+	for i, pattern := range c.Include {
+		if !filepath.IsAbs(pattern) {
+			pattern = filepath.Join(filepath.Dir(file), pattern)
+		}
+		patterns[i] = pattern
+	}
+	return patterns
+}
+
+// include appends the servers of the files matching the include patterns to the servers of c, the files being
+// read in the order of the patterns, and in lexical order for each pattern. file is the configuration file,
+// which is never included in itself.
+func (c *config) include(file string) ValidationError {
+	var invalid ValidationError
+	seen := map[string]bool{filepath.Clean(file): true}
+	for i, pattern := range c.includePatterns(file) {
+		field := fmt.Sprintf("include[%d]", i)
+		matches, err := filepath.Glob(pattern)
+		if err != nil {
+			invalid = append(invalid, Problem{Field: field, Message: fmt.Sprintf("invalid pattern %q, %s", pattern, err)})
+			continue
+		}
+		if len(matches) == 0 && !hasMeta(pattern) {
+			// A glob may match no file yet, whereas a path must exist
+			invalid = append(invalid, Problem{Field: field, Message: fmt.Sprintf("%s doesn't exist", pattern)})
+			continue
+		}
+		sort.Strings(matches)
+		for _, match := range matches {
+			if seen[filepath.Clean(match)] {
+				continue
+			}
+			seen[filepath.Clean(match)] = true
+			servers, problems := readIncluded(match)
+			invalid = append(invalid, problems...)
+			c.Servers = append(c.Servers, servers...)
+		}
+	}
+	return invalid
+}
+
+// readIncluded reads the servers declared in the included file at path
+func readIncluded(path string) ([]Server, ValidationError) {
+	if info, err := os.Stat(path); err == nil && info.IsDir() {
+		return nil, nil
+	}
+	v := viper.New()
+	v.SetConfigFile(path)
+	if err := v.ReadInConfig(); err != nil {
+		return nil, ValidationError{{Field: path, Message: err.Error()}}
+	}
+	var inc included
+	var invalid ValidationError
+	if err := v.Unmarshal(&inc); err != nil {
+		var decodeErr *mapstructure.Error
+		if !errors.As(err, &decodeErr) {
+			return nil, ValidationError{{Field: path, Message: err.Error()}}
+		}
+		for _, msg := range decodeErr.Errors {
+			invalid = append(invalid, Problem{Field: path, Message: msg})
+		}
+	}
+	for i := range inc.Servers {
+		inc.Servers[i].File = path
+	}
+	return inc.Servers, invalid
+}
+
+// hasMeta reports whether pattern contains any of the special characters of filepath.Match
+func hasMeta(pattern string) bool {
+	for _, c := range pattern {
+		switch c {
+		case '*', '?', '[', '\\':
+			return true
+		}
+	}
+	return false
+}
+
+// serverPaths returns the field path of every server, the servers of the included files being
+// prefixed with their file, e.g. servers.d/eu.yaml:servers[1]
+func serverPaths(servers []Server) []string {
+	paths := make([]string, len(servers))
+	indices := make(map[string]int)
+	for i, server := range servers {
+		idx := indices[server.File]
+		indices[server.File]++
+		paths[i] = fmt.Sprintf("servers[%d]", idx)
+		if server.File != "" {
+			paths[i] = server.File + ":" + paths[i]
+		}
+	}
+	return paths
+}
+
+// includeWatcher watches the directories of the include patterns, so that the included files are
+// reloaded when changed, along with the ones added afterwards
+type includeWatcher struct {
+	file    string
+	watcher *fsnotify.Watcher
+}
+
+// newIncludeWatcher returns a watcher of the files included by the configuration file at file
+func newIncludeWatcher(file string) (*includeWatcher, error) {
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		return nil, fmt.Errorf("failed to watch the included files, %w", err)
+	}
+	w := &includeWatcher{file: file, watcher: watcher}
+	return w, w.sync()
+}
+
+// sync watches the directories of the current include patterns, the directories of the patterns which
+// were removed are kept watched, the changes in them being ignored
+func (w *includeWatcher) sync() error {
+	for _, pattern := range Current().includePatterns(w.file) {
+		// The directories may be globs too, e.g. teams/*/servers.yaml
+		dirs, err := filepath.Glob(filepath.Dir(pattern))
+		if err != nil {
+			// Reported by the validation
+			continue
+		}
+		for _, dir := range dirs {
+			if err := w.watcher.Add(dir); err != nil {
+				return fmt.Errorf("failed to watch %s, %w", dir, err)
+			}
+		}
+	}
+	return nil
+}
+
+// matches reports whether the file at name is included by the configuration
+func (w *includeWatcher) matches(name string) bool {
+	if filepath.Clean(name) == filepath.Clean(w.file) {
+		// Watched along with the configuration
+		return false
+	}
+	for _, pattern := range Current().includePatterns(w.file) {
+		if ok, _ := filepath.Match(pattern, name); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// run calls reload whenever an included file is created, changed or removed
+func (w *includeWatcher) run(reload func()) {
+	for {
+		select {
+		case event, ok := <-w.watcher.Events:
+			if !ok {
+				return
+			}
+			if event.Op&fsnotify.Chmod == 0 && w.matches(event.Name) {
+				reload()
+			}
+		case _, ok := <-w.watcher.Errors:
+			if !ok {
+				return
+			}
+		}
+	}
+}
@@ -0,0 +1,33 @@
+package config
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// dscpClasses maps the names of the DiffServ classes to their code points
+var dscpClasses = map[string]int{
+	"cs0": 0, "cs1": 8, "cs2": 16, "cs3": 24, "cs4": 32, "cs5": 40, "cs6": 48, "cs7": 56,
+	"af11": 10, "af12": 12, "af13": 14,
+	"af21": 18, "af22": 20, "af23": 22,
+	"af31": 26, "af32": 28, "af33": 30,
+	"af41": 34, "af42": 36, "af43": 38,
+	"ef": 46, "va": 44, "le": 1,
+}
+
+// ParseDSCP returns the code point of the DSCP class, either a name e.g. EF or AF41, or a number up to 63.
+// An empty class is the default one, i.e. 0.
+func ParseDSCP(class string) (int, error) {
+	if class == "" {
+		return 0, nil
+	}
+	if value, ok := dscpClasses[strings.ToLower(class)]; ok {
+		return value, nil
+	}
+	value, err := strconv.Atoi(class)
+	if err != nil || value < 0 || value > 63 {
+		return 0, fmt.Errorf("must be a class name e.g. EF or AF41, or a number between 0 and 63, got %q", class)
+	}
+	return value, nil
+}
@@ -0,0 +1,107 @@
+package config
+
+import (
+	"github.com/spf13/pflag"
+	"github.com/spf13/viper"
+	"reflect"
+	"strings"
+)
+
+// EnvPrefix is the prefix of the environment variables overriding the settings, e.g. EKKO_WORKER_POOL_SIZE
+const EnvPrefix = "EKKO"
+
+// overrides holds the settings given on the command line, which take precedence over the configuration file
+var overrides struct {
+	// file is the path of the configuration file, it is searched for when empty
+	file string
+	// flags maps the settings keys to the flags overriding them
+	flags map[string]*pflag.Flag
+	// values maps the settings keys to the values overriding them
+	values map[string]interface{}
+	// targets replace the configured servers when set
+	targets []string
+}
+
+// SetFile uses the configuration file at path, rather than searching for it
+func SetFile(path string) {
+	overrides.file = path
+}
+
+// BindFlag overrides the setting at key with flag, when the flag is set on the command line
+func BindFlag(key string, flag *pflag.Flag) {
+	if overrides.flags == nil {
+		overrides.flags = make(map[string]*pflag.Flag)
+	}
+	overrides.flags[key] = flag
+}
+
+// Override sets the setting at key to value, irrespective of the configuration file
+func Override(key string, value interface{}) {
+	if overrides.values == nil {
+		overrides.values = make(map[string]interface{})
+	}
+	overrides.values[key] = value
+}
+
+// SetTargets replaces the configured servers with the given addresses, probed over ICMP
+func SetTargets(addresses []string) {
+	overrides.targets = addresses
+}
+
+// applyOverrides binds the environment variables & the command line overrides to v
+func applyOverrides(v *viper.Viper) error {
+	v.SetEnvPrefix(EnvPrefix)
+	v.SetEnvKeyReplacer(strings.NewReplacer(".", "_"))
+	v.AutomaticEnv()
+	// Bind every setting explicitly, as the automatic binding only applies to the keys present in the file
+	for _, key := range settingsKeys(reflect.TypeOf(config{}), "") {
+		if err := v.BindEnv(key); err != nil {
+			return err
+		}
+	}
+	for key, flag := range overrides.flags {
+		// Bind only the flags which are set, so that their defaults don't take precedence over the file
+		if !flag.Changed {
+			continue
+		}
+		if err := v.BindPFlag(key, flag); err != nil {
+			return err
+		}
+	}
+	for key, value := range overrides.values {
+		v.Set(key, value)
+	}
+	return nil
+}
+
+// applyTargets replaces the servers of c with the targets given on the command line, if any
+func applyTargets(c *config) {
+	if len(overrides.targets) == 0 {
+		return
+	}
+	c.Servers = make([]Server, len(overrides.targets))
+	for i, address := range overrides.targets {
+		c.Servers[i] = Server{Name: address, Address: address}
+	}
+}
+
+// settingsKeys returns the keys of the scalar settings of t, the lists & maps (e.g. servers) can only be
+// set in the configuration file
+func settingsKeys(t reflect.Type, prefix string) []string {
+	var keys []string
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		key := field.Tag.Get("mapstructure")
+		if key == "" {
+			key = strings.ToLower(field.Name)
+		}
+		switch field.Type.Kind() {
+		case reflect.Struct:
+			keys = append(keys, settingsKeys(field.Type, prefix+key+".")...)
+		case reflect.Slice, reflect.Map:
+		default:
+			keys = append(keys, prefix+key)
+		}
+	}
+	return keys
+}
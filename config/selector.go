@@ -0,0 +1,105 @@
+package config
+
+import (
+	"fmt"
+	"strings"
+)
+
+// requirement is a single term of a selector, matching the value of a label
+type requirement struct {
+	key   string
+	value string
+	// exists only requires the label to be set, or unset when negated
+	exists  bool
+	negated bool
+}
+
+func (r requirement) matches(labels map[string]interface{}) bool {
+	value, ok := labels[r.key]
+	if r.exists {
+		return ok != r.negated
+	}
+	equal := ok && fmt.Sprint(value) == r.value
+	return equal != r.negated
+}
+
+// Selector matches the servers by their labels, all of its requirements must be met
+type Selector []requirement
+
+// ParseSelector parses a comma separated list of requirements on the labels of a server, each being either
+// key=value, key!=value, key (the label is set) or !key (the label isn't set), e.g. provider=Riot,region!=eu.
+// An empty expression matches every server.
+func ParseSelector(expr string) (Selector, error) {
+	var selector Selector
+	for _, term := range strings.Split(expr, ",") {
+		term = strings.TrimSpace(term)
+		if term == "" {
+			continue
+		}
+		var r requirement
+		if i := strings.Index(term, "!="); i >= 0 {
+			r = requirement{key: term[:i], value: term[i+2:], negated: true}
+		} else if i := strings.Index(term, "="); i >= 0 {
+			r = requirement{key: term[:i], value: term[i+1:]}
+		} else if strings.HasPrefix(term, "!") {
+			r = requirement{key: term[1:], exists: true, negated: true}
+		} else {
+			r = requirement{key: term, exists: true}
+		}
+		// The label keys are lower cased when the configuration is read
+		r.key, r.value = strings.ToLower(strings.TrimSpace(r.key)), strings.TrimSpace(r.value)
+		if r.key == "" {
+			return nil, fmt.Errorf("missing label key in %q", term)
+		}
+		selector = append(selector, r)
+	}
+	return selector, nil
+}
+
+// Matches reports whether the labels meet all the requirements of the selector
+func (s Selector) Matches(labels map[string]interface{}) bool {
+	for _, r := range s {
+		if !r.matches(labels) {
+			return false
+		}
+	}
+	return true
+}
+
+// assignGroups sets the group of every server to the first group selecting it
+func (c *config) assignGroups() {
+	selectors := make([]Selector, len(c.Groups))
+	for i, group := range c.Groups {
+		// The selectors are validated beforehand
+		selectors[i], _ = ParseSelector(group.Selector)
+	}
+	for i := range c.Servers {
+		c.Servers[i].Group = ""
+		for j, selector := range selectors {
+			if selector.Matches(c.Servers[i].Labels) {
+				c.Servers[i].Group = c.Groups[j].Name
+				break
+			}
+		}
+	}
+}
+
+// selectServers drops the servers which aren't selected by the selector, or aren't part of RunGroups when set
+func (c *config) selectServers() {
+	selector, _ := ParseSelector(c.Selector)
+	groups := make(map[string]bool, len(c.RunGroups))
+	for _, name := range c.RunGroups {
+		groups[name] = true
+	}
+	selected := c.Servers[:0]
+	for _, server := range c.Servers {
+		if !selector.Matches(server.Labels) {
+			continue
+		}
+		if len(groups) > 0 && !groups[server.Group] {
+			continue
+		}
+		selected = append(selected, server)
+	}
+	c.Servers = selected
+}
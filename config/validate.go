@@ -0,0 +1,327 @@
+package config
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// maxPacketSize is the largest payload of an ICMP echo request over IPv4
+const maxPacketSize = 65507
+
+// invalidLabelChars matches the characters which aren't allowed in the names of the Prometheus labels
+var invalidLabelChars = regexp.MustCompile(`[^a-zA-Z0-9_]`)
+
+// MetricLabel returns the name of the Prometheus label exporting the server label key
+func MetricLabel(key string) string {
+	return "label_" + invalidLabelChars.ReplaceAllString(key, "_")
+}
+
+// Problem is an invalid setting found in the configuration
+type Problem struct {
+	// Field is the path of the setting, e.g. servers[2].port
+	Field   string
+	Message string
+}
+
+func (p Problem) String() string {
+	if p.Field == "" {
+		return p.Message
+	}
+	return fmt.Sprintf("%s: %s", p.Field, p.Message)
+}
+
+// ValidationError lists all the problems found in the configuration
+type ValidationError []Problem
+
+func (e ValidationError) Error() string {
+	problems := make([]string, len(e))
+	for i, p := range e {
+		problems[i] = p.String()
+	}
+	return fmt.Sprintf("invalid configuration, %s", strings.Join(problems, "; "))
+}
+
+// ServerValidator returns the problems found with the settings of a server, with their field
+// paths relative to the server
+type ServerValidator func(server Server) []Problem
+
+var serverValidators []ServerValidator
+
+// RegisterServerValidator adds a validation run against every server, allowing the packages
+// using the server settings (e.g. the probers) to validate the ones they own
+func RegisterServerValidator(validator ServerValidator) {
+	serverValidators = append(serverValidators, validator)
+}
+
+// problems collects the problems found during the validation
+type problems []Problem
+
+func (p *problems) add(field, format string, args ...interface{}) {
+	*p = append(*p, Problem{Field: field, Message: fmt.Sprintf(format, args...)})
+}
+
+// validate checks the whole configuration, returning all the problems found in it
+func (c *config) validate() ValidationError {
+	var found problems
+
+	if c.MinPacketNum < 1 {
+		found.add("min_packet_num", "must be at least 1, got %d", c.MinPacketNum)
+	}
+	if c.MaxPacketNum < c.MinPacketNum {
+		found.add("max_packet_num", "must be greater than or equal to min_packet_num (%d), got %d",
+			c.MinPacketNum, c.MaxPacketNum)
+	}
+	if c.PingTimeout <= 0 {
+		found.add("ping_timeout", "must be a positive number of seconds, got %d", c.PingTimeout)
+	}
+	if c.PingInterval <= 0 {
+		found.add("ping_interval", "must be a positive number of seconds, got %d", c.PingInterval)
+	}
+	if c.PingJitter < 0 {
+		found.add("ping_jitter", "must not be negative, got %d", c.PingJitter)
+	}
+	if c.WorkerPoolSize < 1 {
+		found.add("worker_pool_size", "must be at least 1, got %d", c.WorkerPoolSize)
+	}
+	found.packetSize("packet_size", c.PacketSize)
+	found.ttl("ttl", c.TTL)
+	found.dscp("dscp", c.DSCP)
+	switch strings.ToLower(c.ICMPPrivilege) {
+	case "auto", "privileged", "unprivileged":
+	default:
+		found.add("icmp_privilege", "must be one of auto, privileged or unprivileged, got %q", c.ICMPPrivilege)
+	}
+	if c.Logging.ConsoleEnabled && c.UIEnabled {
+		found.add("logging.console_enabled", "can't be enabled along with ui_enabled")
+	}
+
+	if c.Thresholds.Rtt.Warn > c.Thresholds.Rtt.Error {
+		found.add("thresholds.rtt.warn", "must not be greater than thresholds.rtt.error (%d), got %d",
+			c.Thresholds.Rtt.Error, c.Thresholds.Rtt.Warn)
+	}
+	if c.Thresholds.Loss.Warn > c.Thresholds.Loss.Error {
+		found.add("thresholds.loss.warn", "must not be greater than thresholds.loss.error (%g), got %g",
+			c.Thresholds.Loss.Error, c.Thresholds.Loss.Warn)
+	}
+	if c.Thresholds.MOS.Warn < c.Thresholds.MOS.Error {
+		found.add("thresholds.mos.warn", "must not be lower than thresholds.mos.error (%g), got %g",
+			c.Thresholds.MOS.Error, c.Thresholds.MOS.Warn)
+	}
+
+	if c.Metrics.Enabled {
+		if c.Metrics.Listen == "" {
+			found.add("metrics.listen", "must not be empty")
+		}
+		if !strings.HasPrefix(c.Metrics.Path, "/") {
+			found.add("metrics.path", "must start with /, got %q", c.Metrics.Path)
+		}
+		found.metricLabels(c.Servers)
+	}
+	if c.API.Enabled {
+		if c.API.Listen == "" {
+			found.add("api.listen", "must not be empty")
+		}
+		if c.API.HistorySize < 1 {
+			found.add("api.history_size", "must be at least 1, got %d", c.API.HistorySize)
+		}
+	}
+
+	found.servers(c)
+	found.groups(c)
+	return ValidationError(found)
+}
+
+// servers checks the settings of every server of c, and that the servers don't collide with each other
+func (p *problems) servers(c *config) {
+	servers := c.Servers
+	if len(servers) == 0 {
+		p.add("servers", "at least one server is required")
+	}
+	// The paths of the first servers using each name
+	names := make(map[string]string)
+	paths := serverPaths(servers)
+	for i, server := range servers {
+		path := paths[i]
+
+		if server.Name == "" {
+			p.add(path+".name", "must not be empty")
+		} else if first, ok := names[server.Name]; ok {
+			p.add(path+".name", "%q is already used by %s", server.Name, first)
+		} else {
+			names[server.Name] = path
+		}
+
+		if server.Address == "" {
+			p.add(path+".address", "must not be empty")
+		}
+
+		switch server.IPFamily {
+		case "", IPv4, IPv6, BothIPs:
+		default:
+			p.add(path+".ip_family", "must be one of v4, v6 or both, got %q", server.IPFamily)
+		}
+		if server.Port < 0 || server.Port > 65535 {
+			p.add(path+".port", "must be 0 (unset) or between 1 and 65535, got %d", server.Port)
+		}
+		p.overrides(c, server, path)
+
+		for _, validate := range serverValidators {
+			for _, problem := range validate(server) {
+				problem.Field = path + "." + problem.Field
+				*p = append(*p, problem)
+			}
+		}
+	}
+	p.targets(servers, paths, paths)
+}
+
+// metricLabels checks that the label keys of the servers are exported as distinct metric labels, as the
+// characters not allowed by Prometheus are replaced, e.g. both a-b and a.b become label_a_b
+func (p *problems) metricLabels(servers []Server) {
+	// The first keys exported as each metric label, along with the paths of the servers they're set on
+	exported := make(map[string]string)
+	keys := make(map[string]bool)
+	paths := serverPaths(servers)
+	for i, server := range servers {
+		var names []string
+		for key := range server.Labels {
+			names = append(names, key)
+		}
+		sort.Strings(names)
+		for _, key := range names {
+			label := MetricLabel(key)
+			if first, ok := exported[label]; ok && !keys[key] {
+				p.add(paths[i]+".labels."+key, "is exported as %s like %s", label, first)
+				continue
+			}
+			if !keys[key] {
+				exported[label] = fmt.Sprintf("%q of %s", key, paths[i])
+				keys[key] = true
+			}
+		}
+	}
+}
+
+// targets checks that none of the servers probes the target of another one. The problems are reported on
+// the paths of the servers, along with the description of the first server probing the target.
+func (p *problems) targets(servers []Server, paths, descriptions []string) {
+	// The indices of the first servers probing each target
+	targets := make(map[string]int)
+	for i, server := range servers {
+		if server.Address == "" {
+			continue
+		}
+		// The same destination may be probed from several sources, over several IP families, or with
+		// several DSCP classes
+		target := fmt.Sprintf("%s://%s:%d %s %s %s", strings.ToLower(server.Protocol), server.Address, server.Port,
+			server.Source, server.IPFamily, strings.ToLower(server.DSCP))
+		if first, ok := targets[target]; ok {
+			p.add(paths[i]+".address", "%s is already probed by %s", server.Address, descriptions[first])
+		} else {
+			targets[target] = i
+		}
+	}
+}
+
+// discovered checks the servers left once the generators are expanded and the servers split over both IP
+// families, as they may probe the target of another server, or be named like another one, e.g. a declared
+// Mumbai (IPv6) along with a Mumbai server probed over both families. The servers are described by their
+// name, as the ones discovered by the same generator share its path. The generators left unresolved are skipped.
+func (c *config) discovered() ValidationError {
+	var found problems
+	var servers []Server
+	var paths, names []string
+	// The paths of the first servers using each name
+	used := make(map[string]string)
+	for _, server := range c.Servers {
+		if first, ok := used[server.Name]; ok {
+			found.add(server.path+".name", "%q is already used by %s", server.Name, first)
+		} else {
+			used[server.Name] = server.path
+		}
+		if server.Generates() {
+			continue
+		}
+		servers = append(servers, server)
+		paths, names = append(paths, server.path), append(names, strconv.Quote(server.Name))
+	}
+	found.targets(servers, paths, names)
+	return ValidationError(found)
+}
+
+// overrides checks the probe settings of server, the ones inherited from the global settings are checked with them
+func (p *problems) overrides(c *config, server Server, path string) {
+	if server.PacketCount < 0 {
+		p.add(path+".packet_count", "must be at least 1, got %d", server.PacketCount)
+	} else if server.MinPacketNum != c.MinPacketNum || server.MaxPacketNum != c.MaxPacketNum {
+		if server.MinPacketNum < 1 {
+			p.add(path+".min_packet_num", "must be at least 1, got %d", server.MinPacketNum)
+		} else if server.MaxPacketNum < server.MinPacketNum {
+			p.add(path+".max_packet_num", "must be greater than or equal to min_packet_num (%d), got %d",
+				server.MinPacketNum, server.MaxPacketNum)
+		}
+	}
+	if server.PingTimeout != c.PingTimeout && server.PingTimeout <= 0 {
+		p.add(path+".ping_timeout", "must be a positive number of seconds, got %d", server.PingTimeout)
+	}
+	if server.PingInterval != c.PingInterval && server.PingInterval <= 0 {
+		p.add(path+".ping_interval", "must be a positive number of seconds, got %d", server.PingInterval)
+	}
+	if server.PacketSize != c.PacketSize {
+		p.packetSize(path+".packet_size", server.PacketSize)
+	}
+	if server.TTL != c.TTL {
+		p.ttl(path+".ttl", server.TTL)
+	}
+	if server.DSCP != c.DSCP {
+		p.dscp(path+".dscp", server.DSCP)
+	}
+}
+
+// packetSize, ttl & dscp check the settings which may be set globally, as well as per server
+func (p *problems) packetSize(field string, size int) {
+	if size < 0 || size > maxPacketSize {
+		p.add(field, "must be 0 (unset) or between 1 and %d bytes, got %d", maxPacketSize, size)
+	}
+}
+
+func (p *problems) ttl(field string, ttl int) {
+	if ttl < 0 || ttl > 255 {
+		p.add(field, "must be 0 (unset) or between 1 and 255, got %d", ttl)
+	}
+}
+
+func (p *problems) dscp(field, class string) {
+	if _, err := ParseDSCP(class); err != nil {
+		p.add(field, "%s", err)
+	}
+}
+
+// groups checks the groups of c, along with the selection of the servers run
+func (p *problems) groups(c *config) {
+	names := make(map[string]int)
+	for i, group := range c.Groups {
+		path := fmt.Sprintf("groups[%d]", i)
+		if group.Name == "" {
+			p.add(path+".name", "must not be empty")
+		} else if first, ok := names[group.Name]; ok {
+			p.add(path+".name", "%q is already used by groups[%d]", group.Name, first)
+		} else {
+			names[group.Name] = i
+		}
+		if _, err := ParseSelector(group.Selector); err != nil {
+			p.add(path+".selector", "%s", err)
+		}
+	}
+	if _, err := ParseSelector(c.Selector); err != nil {
+		p.add("selector", "%s", err)
+	}
+	for i, name := range c.RunGroups {
+		if _, ok := names[name]; !ok {
+			p.add(fmt.Sprintf("run_groups[%d]", i), "unknown group %q", name)
+		}
+	}
+}
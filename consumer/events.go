@@ -1,49 +1,98 @@
 package consumer
 
 import (
-	"github.com/go-ping/ping"
+	"context"
 	"github.com/soheltarir/ekko/config"
 	"github.com/soheltarir/ekko/logger"
+	"github.com/soheltarir/ekko/probe"
 	"github.com/soheltarir/ekko/ui"
 	"go.uber.org/zap"
+	"sync/atomic"
 )
 
-// CallbackFunc is invoked each time the producer sends an event
-func (c *Consumer) CallbackFunc(event Event) {
+// CallbackFunc is invoked each time the producer sends an event, it blocks until the event is picked up.
+// The event is dropped once ctx is done, returning its error, or once the consumer stops, returning ErrStopped.
+func (c *Consumer) CallbackFunc(ctx context.Context, event Event) error {
+	atomic.AddInt32(&c.queued, 1)
 	logger.Log.Debug("Attempting to send event to ingestion channel", zap.Any("event", event))
-	c.channels.ingestion <- event
+	select {
+	case c.channels.ingestion <- event:
+	case <-ctx.Done():
+		atomic.AddInt32(&c.queued, -1)
+		logger.Log.Debug("Dropped event, the sender is cancelled", zap.Any("event", event))
+		return ctx.Err()
+	case <-c.stopped:
+		atomic.AddInt32(&c.queued, -1)
+		logger.Log.Debug("Dropped event, the consumer is stopping", zap.Any("event", event))
+		return ErrStopped
+	}
 	logger.Log.Debug("Sent event to ingestion channel", zap.Any("event", event))
+	return nil
 }
 
-// notifyTableRenderer sends an event to the table renderer with new data
-func (c *Consumer) notifyTableRenderer(dest config.Server, stats *ping.Statistics, err error) {
-	// Skip sending an event if UI is disabled or the consumer is not running
-	if !config.Config.UIEnabled || c.Status != config.Running {
+// publish notifies the table renderer and the registered handlers of the outcome of a ping job
+func (c *Consumer) publish(job Event, result *probe.Result, err error) {
+	dest := job.Destination
+	c.notifyTableRenderer(dest, result, err)
+	for _, handler := range c.handlers {
+		handler(dest, result, err)
+	}
+	if job.OutOfBand {
 		return
 	}
+	for _, handler := range c.scheduledHandlers {
+		handler(dest, result, err)
+	}
+}
 
-	// acquire lock
+// notifyTableRenderer sends an event to the table renderer with new data
+func (c *Consumer) notifyTableRenderer(dest config.Server, result *probe.Result, err error) {
+	// acquire lock, the ui channel is closed under it on shutdown
 	c.lock.Lock()
 	defer c.lock.Unlock()
 
+	// Skip sending an event if UI is disabled or the consumer is not running
+	if !c.uiEnabled || c.Status() != config.Running {
+		return
+	}
+
 	// create a new event
-	event := ui.NewTableRowEvent(dest, stats, err)
+	event := ui.NewTableRowEvent(dest, result, err)
 
 	logger.Log.Debug("Attempting to send UI event", zap.Any("event", event))
 	c.channels.ui <- event
 	logger.Log.Debug("Successfully sent UI event", zap.Any("key", event))
 }
 
-func (c *Consumer) notifyStatusRenderer(status config.ConsumerStatus) {
+// notifyDestinationsRenderer sends an event to the table renderer with the updated destinations
+func (c *Consumer) notifyDestinationsRenderer(servers []config.Server) {
+	// acquire lock, the ui channel is closed under it on shutdown
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
 	// Skip sending an event if UI is disabled or the consumer is not running
-	if !config.Config.UIEnabled || c.Status != config.Running {
+	if !c.uiEnabled || c.Status() != config.Running {
 		return
 	}
 
-	// acquire lock
+	// create a new event
+	event := ui.NewDestinationsEvent(servers)
+
+	logger.Log.Debug("Attempting to send UI event", zap.Any("event", event))
+	c.channels.ui <- event
+	logger.Log.Debug("Successfully sent UI event", zap.Any("event", event))
+}
+
+func (c *Consumer) notifyStatusRenderer(status config.ConsumerStatus) {
+	// acquire lock, the ui channel is closed under it on shutdown
 	c.lock.Lock()
 	defer c.lock.Unlock()
 
+	// Skip sending an event if UI is disabled or the consumer is not running
+	if !c.uiEnabled || c.Status() != config.Running {
+		return
+	}
+
 	// create a new event
 	event := ui.NewStatusEvent(status)
 
@@ -1,7 +1,7 @@
 package consumer
 
 import (
-	"github.com/go-ping/ping"
+	"github.com/google/uuid"
 	"github.com/soheltarir/ekko/config"
 	"github.com/soheltarir/ekko/logger"
 	"go.uber.org/zap"
@@ -20,23 +20,26 @@ func (c *Consumer) closeUiChannel() {
 // stopActiveJobs attempts to stop all actively running ping jobs
 func (c *Consumer) stopActiveJobs() {
 	c.activeJobs.Range(func(key, value interface{}) bool {
-		job := value.(*ping.Pinger)
-		logger.Log.Warn("Stopping ping job", zap.Int("job_id", key.(int)),
-			zap.String("address", job.Addr()))
-		job.Stop()
-		logger.Log.Debug("Successfully stopped job", zap.Int("job_id", key.(int)),
-			zap.String("address", job.Addr()))
+		job := value.(activeJob)
+		logger.Log.Warn("Stopping ping job", zap.String("job_id", key.(uuid.UUID).String()),
+			zap.String("address", job.destination.Address))
+		job.cancel()
+		logger.Log.Debug("Successfully stopped job", zap.String("job_id", key.(uuid.UUID).String()),
+			zap.String("address", job.destination.Address))
 		return true
 	})
 }
 
 // HandleShutdown method triggers all stop instructions when a shutdown signal is received
 func (c *Consumer) HandleShutdown() {
-	c.Status = config.Stopped
+	c.pool.Lock()
+	c.status = config.Stopped
+	c.pool.Unlock()
+	close(c.stopped)
 	logger.Log.Warn("Consumer received cancellation signal, closing jobs channel")
 	close(c.channels.job)
 	logger.Log.Debug("Jobs channel successfully closed")
 	c.stopActiveJobs()
-	c.notifyStatusRenderer(c.Status)
+	c.notifyStatusRenderer(config.Stopped)
 	c.closeUiChannel()
 }
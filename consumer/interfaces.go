@@ -1,10 +1,13 @@
 package consumer
 
 import (
+	"errors"
 	"github.com/google/uuid"
 	"github.com/soheltarir/ekko/config"
+	"github.com/soheltarir/ekko/probe"
 	"github.com/soheltarir/ekko/ui"
 	"sync"
+	"sync/atomic"
 	"time"
 )
 
@@ -13,6 +16,8 @@ type Event struct {
 	ID          uuid.UUID
 	Destination config.Server
 	SentOn      time.Time
+	// OutOfBand is set on the events sent on demand, rather than by the scheduler
+	OutOfBand bool
 }
 
 // NewEvent creates a new ping job
@@ -35,14 +40,42 @@ type channels struct {
 	ui chan ui.Event
 }
 
+// ErrStopped is returned when an event is sent to a consumer which is stopping
+var ErrStopped = errors.New("consumer is stopping")
+
+// ResultHandler is invoked with the outcome of every ping job, result is nil when err is set
+type ResultHandler func(dest config.Server, result *probe.Result, err error)
+
+// workerPool contains the quit channels of the running workers, in the order they were spawned
+type workerPool struct {
+	sync.Mutex
+	quit   []chan struct{}
+	nextID int
+}
+
 // Consumer exposes methods and parameters to control the behaviour of the ping workers
 type Consumer struct {
 	channels channels
 	// activeJobs contains the list of actively running ping jobs
 	activeJobs sync.Map
 	lock       sync.Mutex
-	// Status defines the current running state of the consumer
-	Status config.ConsumerStatus
+	// status defines the current running state of the consumer, it is guarded by the pool lock
+	status config.ConsumerStatus
+	// handlers are notified of the outcome of every ping job, scheduledHandlers of the ones which aren't out-of-band
+	handlers          []ResultHandler
+	scheduledHandlers []ResultHandler
+	// stopped is closed once the consumer stops, so that the events sent afterwards are rejected
+	stopped chan struct{}
+	// history keeps the state of the destinations across their ping jobs, e.g. the hops of the traced ones
+	history *probe.History
+	// uiEnabled is captured once, as the UI only listens to the ui channel when it was enabled on start
+	uiEnabled bool
+	// pool tracks the running workers, to resize it
+	pool workerPool
+	// workers, busyWorkers & queued are counters of the worker pool state, accessed atomically
+	workers     int32
+	busyWorkers int32
+	queued      int32
 }
 
 // New returns a new Consumer object
@@ -53,7 +86,44 @@ func New(uiEventChan chan ui.Event) *Consumer {
 		ui:        uiEventChan,
 	}
 	return &Consumer{
-		channels: channels,
-		Status:   config.NotStarted,
+		channels:  channels,
+		status:    config.NotStarted,
+		stopped:   make(chan struct{}),
+		history:   probe.NewHistory(),
+		uiEnabled: config.Current().UIEnabled,
 	}
 }
+
+// OnResult registers a handler to be notified of the outcome of every ping job.
+// Handlers must be registered before the workers are spawned.
+func (c *Consumer) OnResult(handler ResultHandler) {
+	c.handlers = append(c.handlers, handler)
+}
+
+// Status returns the current running state of the consumer
+func (c *Consumer) Status() config.ConsumerStatus {
+	c.pool.Lock()
+	defer c.pool.Unlock()
+	return c.status
+}
+
+// OnScheduledResult registers a handler to be notified of the outcome of the ping jobs sent by the scheduler,
+// the out-of-band ones are left out. Handlers must be registered before the workers are spawned.
+func (c *Consumer) OnScheduledResult(handler ResultHandler) {
+	c.scheduledHandlers = append(c.scheduledHandlers, handler)
+}
+
+// Workers returns the number of running workers
+func (c *Consumer) Workers() int {
+	return int(atomic.LoadInt32(&c.workers))
+}
+
+// BusyWorkers returns the number of workers currently running a ping job
+func (c *Consumer) BusyWorkers() int {
+	return int(atomic.LoadInt32(&c.busyWorkers))
+}
+
+// QueueLength returns the number of events waiting for a free worker
+func (c *Consumer) QueueLength() int {
+	return int(atomic.LoadInt32(&c.queued))
+}
@@ -1,64 +1,95 @@
 package consumer
 
 import (
-	"github.com/go-ping/ping"
+	"context"
 	"github.com/soheltarir/ekko/config"
+	"github.com/soheltarir/ekko/probe"
 	"go.uber.org/zap"
-	"math/rand"
-	"time"
 )
 
-func (c *Consumer) ping(destination config.Server, log *zap.Logger) {
+func (c *Consumer) ping(job Event, log *zap.Logger) {
+	destination := job.Destination
 	// Initialise a base logger
 	log = log.With(
 		zap.String("server_name", destination.Name),
 		zap.String("server_ip", destination.Address),
 		zap.Any("labels", destination.Labels),
 	)
-	pingThread, err := ping.NewPinger(destination.Address)
+	if destination.IPFamily != "" {
+		log = log.With(zap.String("ip_family", destination.IPFamily))
+	}
+	if destination.Source != "" {
+		log = log.With(zap.String("source", destination.Source))
+	}
+	if destination.PacketSize > 0 {
+		log = log.With(zap.Int("packet_size", destination.PacketSize))
+	}
+	if destination.TTL > 0 {
+		log = log.With(zap.Int("ttl", destination.TTL))
+	}
+	if destination.DSCP != "" {
+		log = log.With(zap.String("dscp", destination.DSCP))
+	}
+	if !destination.Fragmentable() {
+		log = log.With(zap.Bool("dont_fragment", true))
+	}
+	prober, err := probe.New(destination.Protocol, c.history)
 	if err != nil {
 		log.Error("Failed to initialise ping", zap.Error(err))
-		c.notifyTableRenderer(destination, nil, err)
+		c.publish(job, nil, err)
 		return
 	}
 
-	// Randomize the count of packets to be sent
-	rand.Seed(time.Now().UnixNano())
-	pingThread.Count = rand.Intn(config.Config.MaxPacketNum-config.Config.MinPacketNum) + config.Config.MinPacketNum
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
 
-	// Set the timeout for a packet to consider it as failed
-	pingThread.Timeout = time.Second * time.Duration(config.Config.PingTimeout)
+	log.Info("Ping started", zap.String("protocol", destination.Protocol))
+	// Add the ping job to active list, so that it could be cancelled on shutdown
+	c.activeJobs.Store(job.ID, activeJob{destination: destination, cancel: cancel})
+	// Delete the ping job from active list once it is done
+	defer c.activeJobs.Delete(job.ID)
 
-	// Override the default logger
-	pingThread.SetLogger(log.Sugar())
-
-	// Run as privileged user to promote connections to ICMP
-	pingThread.SetPrivileged(true)
-
-	// Initialise a callback function to run when the ping starts
-	pingThread.OnSetup = func() {
-		log.Info("Ping started")
-		// Add the ping job to active list
-		c.activeJobs.Store(pingThread.ID(), pingThread)
-	}
-
-	// Initialise a callback function to run when the ping finishes
-	pingThread.OnFinish = func(s *ping.Statistics) {
-		log.Info("Ping complete",
-			zap.Int("num_packets", s.PacketsSent),
-			zap.Float64("packet_loss", s.PacketLoss),
-			zap.Duration("avg_rtt", s.AvgRtt),
-			zap.Duration("min_rtt", s.MinRtt),
-			zap.Duration("max_rtt", s.MaxRtt),
-		)
-		c.notifyTableRenderer(destination, s, nil)
-		// Delete the ping job from active list
-		c.activeJobs.Delete(pingThread.ID())
-	}
-
-	if err := pingThread.Run(); err != nil {
+	result, err := prober.Probe(ctx, destination, log)
+	if err != nil {
 		log.Error("Failed to run ping", zap.Error(err))
-		c.notifyTableRenderer(destination, nil, err)
+		c.publish(job, nil, err)
 		return
 	}
+	fields := []zap.Field{
+		zap.Int("num_packets", result.PacketsSent),
+		zap.Float64("packet_loss", result.PacketLoss),
+		zap.Float64("mos", result.MOS),
+		zap.Float64("r_factor", result.RFactor),
+		zap.Duration("avg_rtt", result.AvgRtt),
+		zap.Duration("min_rtt", result.MinRtt),
+		zap.Duration("max_rtt", result.MaxRtt),
+		zap.Duration("jitter", result.Jitter),
+		zap.Duration("p50_rtt", result.P50Rtt),
+		zap.Duration("p90_rtt", result.P90Rtt),
+		zap.Duration("p99_rtt", result.P99Rtt),
+		zap.Duration("stddev_rtt", result.StdDevRtt),
+	}
+	if result.HTTP != nil {
+		fields = append(fields, result.HTTP.Fields()...)
+	}
+	if result.DNS != nil {
+		fields = append(fields, result.DNS.Fields()...)
+	}
+	if result.PMTU != nil {
+		fields = append(fields, result.PMTU.Fields()...)
+	}
+	log.Info("Ping complete", fields...)
+	if result.PMTU != nil && result.PMTU.Changed() {
+		log.Info("Path MTU changed", zap.Int("previous_mtu", result.PMTU.Previous), zap.Int("path_mtu", result.PMTU.MTU))
+	}
+	for _, hop := range result.Hops {
+		log.Info("Trace hop", hop.Fields()...)
+	}
+	c.publish(job, result, nil)
+}
+
+// activeJob holds the information required to stop an actively running ping job
+type activeJob struct {
+	destination config.Server
+	cancel      context.CancelFunc
 }
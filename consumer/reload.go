@@ -0,0 +1,16 @@
+package consumer
+
+import (
+	"github.com/soheltarir/ekko/config"
+	"sync"
+)
+
+// Reload applies the reloaded configuration to the consumer, by resizing the worker pool, forgetting the
+// history of the destinations removed and updating the destinations shown in the UI. The running workers
+// are added to wg.
+func (c *Consumer) Reload(wg *sync.WaitGroup) {
+	reloaded := config.Current()
+	c.history.Prune(reloaded.Servers)
+	c.ScaleWorkers(reloaded.WorkerPoolSize, wg)
+	c.notifyDestinationsRenderer(reloaded.Servers)
+}
@@ -6,13 +6,16 @@ import (
 	"github.com/soheltarir/ekko/logger"
 	"go.uber.org/zap"
 	"sync"
+	"sync/atomic"
 )
 
 // Start acts as the proxy between the ingestChan and jobsChan,
 // with a select to support graceful shutdown.
 func (c *Consumer) Start(ctx context.Context) {
-	c.Status = config.Running
-	c.notifyStatusRenderer(c.Status)
+	c.pool.Lock()
+	c.status = config.Running
+	c.pool.Unlock()
+	c.notifyStatusRenderer(config.Running)
 	for {
 		select {
 		case <-ctx.Done():
@@ -20,20 +23,64 @@ func (c *Consumer) Start(ctx context.Context) {
 			return
 		case job := <-c.channels.ingestion:
 			logger.Log.Debug("Received job", zap.Any("event", job))
-			c.channels.job <- job
+			// Every worker may be busy, the shutdown mustn't wait for one of them to be free
+			select {
+			case c.channels.job <- job:
+			case <-ctx.Done():
+				atomic.AddInt32(&c.queued, -1)
+				c.HandleShutdown()
+				return
+			}
 		}
 	}
 }
 
-// SpawnWorker starts a thread which listens for ping job events, and executes them
-func (c *Consumer) SpawnWorker(id int, wg *sync.WaitGroup) {
+// ScaleWorkers spawns or stops workers until size of them are running, every running worker is added to wg.
+// The stopped workers finish their running ping job before exiting.
+func (c *Consumer) ScaleWorkers(size int, wg *sync.WaitGroup) {
+	c.pool.Lock()
+	defer c.pool.Unlock()
+	if c.status == config.Stopped {
+		return
+	}
+
+	for len(c.pool.quit) < size {
+		quit := make(chan struct{})
+		c.pool.quit = append(c.pool.quit, quit)
+		wg.Add(1)
+		go c.SpawnWorker(c.pool.nextID, quit, wg)
+		c.pool.nextID++
+	}
+	for len(c.pool.quit) > size {
+		last := len(c.pool.quit) - 1
+		close(c.pool.quit[last])
+		c.pool.quit = c.pool.quit[:last]
+	}
+}
+
+// SpawnWorker starts a thread which listens for ping job events, and executes them until quit is closed
+func (c *Consumer) SpawnWorker(id int, quit <-chan struct{}, wg *sync.WaitGroup) {
 	defer wg.Done()
 	log := logger.Log.With(zap.Int("worker_id", id))
 	log.Debug("Ping worker started")
+	atomic.AddInt32(&c.workers, 1)
+	defer atomic.AddInt32(&c.workers, -1)
 
-	for job := range c.channels.job {
-		// Run the ping for received event
-		c.ping(job.Destination, log)
+	for {
+		select {
+		case <-quit:
+			log.Warn("Worker removed from the pool, stopping worker...")
+			return
+		case job, ok := <-c.channels.job:
+			if !ok {
+				log.Warn("Shutdown signal received, stopping worker...")
+				return
+			}
+			atomic.AddInt32(&c.queued, -1)
+			atomic.AddInt32(&c.busyWorkers, 1)
+			// Run the ping for received event
+			c.ping(job, log)
+			atomic.AddInt32(&c.busyWorkers, -1)
+		}
 	}
-	log.Warn("Shutdown signal received, stopping worker...")
 }
@@ -0,0 +1,226 @@
+// Package discovery expands the generator servers of the configuration into the servers they discover: the
+// targets of a DNS SRV record, the IP addresses of a name, the hosts of a CIDR range, or the names matching a
+// numeric pattern. The srv & dns generators are resolved again periodically, as their records change.
+package discovery
+
+import (
+	"context"
+	"fmt"
+	"github.com/soheltarir/ekko/config"
+	"github.com/soheltarir/ekko/logger"
+	"github.com/soheltarir/ekko/probe"
+	"go.uber.org/zap"
+	"reflect"
+	"strings"
+	"sync"
+	"time"
+)
+
+// The discovery modes of config.DiscoverOptions
+const (
+	SRV     = "srv"
+	DNS     = "dns"
+	CIDR    = "cidr"
+	Pattern = "pattern"
+)
+
+const (
+	// resolveTimeout bounds the resolution of a generator
+	resolveTimeout = 10 * time.Second
+	// checkInterval is the interval at which the generators are checked for being due to be resolved again
+	checkInterval = time.Second
+)
+
+// generators maps every mode to the function returning the targets of the address of a generator, up to limit
+var generators = map[string]func(ctx context.Context, address string, limit int) ([]target, error){
+	SRV:     lookupSRV,
+	DNS:     lookupIPs,
+	CIDR:    expandCIDR,
+	Pattern: expandPattern,
+}
+
+// resolution is the outcome of the last resolution of a generator
+type resolution struct {
+	targets []target
+	err     error
+	at      time.Time
+	// reported is set once the error is logged
+	reported bool
+}
+
+var (
+	lock sync.Mutex
+	// resolutions are keyed by the generator, see key
+	resolutions = make(map[string]*resolution)
+)
+
+func init() {
+	config.SetDiscoverer(discover)
+	config.RegisterServerValidator(validate)
+}
+
+// key identifies the resolutions of a generator, which are resolved again once its address or mode change
+func key(generator config.Server) string {
+	return fmt.Sprintf("%s/%s/%s", generator.Name, strings.ToLower(generator.Discover.Mode), generator.Address)
+}
+
+// refreshed reports whether the targets of the generator change over time, hence are resolved periodically
+func refreshed(generator config.Server) bool {
+	return generator.LooksUp()
+}
+
+// validate checks the discovery settings of the server, the cidr & pattern generators are expanded so
+// that their syntax & size are checked too
+func validate(server config.Server) []config.Problem {
+	if !server.Generates() {
+		return nil
+	}
+	opts := server.Discover
+	mode := strings.ToLower(opts.Mode)
+	generate, ok := generators[mode]
+	if !ok {
+		return []config.Problem{{
+			Field: "discover.mode", Message: fmt.Sprintf("must be one of srv, dns, cidr or pattern, got %q", opts.Mode),
+		}}
+	}
+	var problems []config.Problem
+	if strings.EqualFold(server.Protocol, probe.HTTP) {
+		problems = append(problems, config.Problem{Field: "discover.mode", Message: "isn't supported by the http protocol"})
+	}
+	if opts.Refresh < 1 {
+		problems = append(problems, config.Problem{Field: "discover.refresh", Message: fmt.Sprintf("must be at least 1, got %d", opts.Refresh)})
+	}
+	if opts.Limit < 1 {
+		problems = append(problems, config.Problem{Field: "discover.limit", Message: fmt.Sprintf("must be at least 1, got %d", opts.Limit)})
+	} else if !refreshed(server) {
+		if _, err := generate(context.Background(), server.Address, opts.Limit); err != nil {
+			problems = append(problems, config.Problem{Field: "address", Message: err.Error()})
+		}
+	}
+	return problems
+}
+
+// discover returns the servers discovered by the generator as per its last resolution, along with the error
+// it failed with. The generator is resolved first when it never was.
+func discover(generator config.Server) ([]config.Server, error) {
+	lock.Lock()
+	res, ok := resolutions[key(generator)]
+	lock.Unlock()
+	if !ok {
+		res = resolve(generator)
+		lock.Lock()
+		resolutions[key(generator)] = res
+		lock.Unlock()
+	}
+
+	servers := make([]config.Server, 0, len(res.targets))
+	for _, t := range res.targets {
+		server := generator
+		server.Discover = config.DiscoverOptions{}
+		server.DiscoveredBy = generator.Name
+		server.Name = fmt.Sprintf("%s (%s)", generator.Name, t)
+		server.Address = t.address
+		if t.port != 0 && server.Port == 0 {
+			server.Port = t.port
+		}
+		// Copy the labels, so that the servers don't share them
+		server.Labels = make(map[string]interface{}, len(generator.Labels))
+		for k, v := range generator.Labels {
+			server.Labels[k] = v
+		}
+		servers = append(servers, server)
+	}
+	return servers, res.err
+}
+
+// resolve returns the targets of the generator, up to its limit
+func resolve(generator config.Server) *resolution {
+	ctx, cancel := context.WithTimeout(context.Background(), resolveTimeout)
+	defer cancel()
+	limit := generator.Discover.Limit
+	targets, err := generators[strings.ToLower(generator.Discover.Mode)](ctx, generator.Address, limit)
+	if len(targets) > limit {
+		logger.Log.Warn("Discovered more servers than the limit, ignoring the rest", zap.String("server_name", generator.Name),
+			zap.Int("discovered", len(targets)), zap.Int("limit", limit))
+		targets = targets[:limit]
+	}
+	return &resolution{targets: targets, err: err, at: time.Now()}
+}
+
+// Run resolves the srv & dns generators of config.Current() again as per their refresh interval, until ctx is
+// done. The configuration is updated once the servers discovered change, and onChange is called then.
+func Run(ctx context.Context, onChange func()) {
+	ticker := time.NewTicker(checkInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			logger.Log.Debug("Discovery received cancellation signal, exiting...")
+			return
+		case <-ticker.C:
+			if !refresh() {
+				continue
+			}
+			changed, err := config.Rediscover()
+			if err != nil {
+				logger.Log.Error("Invalid discovered servers, keeping the previous ones", zap.Error(err))
+				continue
+			}
+			if changed {
+				logger.Log.Info("Discovered servers changed", zap.Int("servers", len(config.Current().Servers)))
+				onChange()
+			}
+		}
+	}
+}
+
+// refresh resolves the generators which are due again, and reports whether any of their targets changed.
+// The previous targets of a generator are kept when it fails to be resolved.
+func refresh() bool {
+	changed := false
+	keys := make(map[string]bool)
+	for _, generator := range config.Current().Declared() {
+		if !generator.Generates() {
+			continue
+		}
+		k := key(generator)
+		keys[k] = true
+		lock.Lock()
+		res, ok := resolutions[k]
+		if ok && res.err != nil && !res.reported {
+			// Failed while loading the configuration, when the logger wasn't set up yet
+			logger.Log.Error("Failed to discover servers", zap.String("server_name", generator.Name), zap.Error(res.err))
+			res.reported = true
+		}
+		lock.Unlock()
+		due := !ok || (refreshed(generator) && time.Since(res.at) >= time.Duration(generator.Discover.Refresh)*time.Second)
+		if !due {
+			continue
+		}
+
+		latest := resolve(generator)
+		if latest.err != nil {
+			logger.Log.Error("Failed to discover servers", zap.String("server_name", generator.Name), zap.Error(latest.err))
+			latest.reported = true
+			if ok {
+				latest.targets = res.targets
+			}
+		}
+		lock.Lock()
+		resolutions[k] = latest
+		lock.Unlock()
+		if !ok || !reflect.DeepEqual(latest.targets, res.targets) {
+			changed = true
+		}
+	}
+
+	// Forget the generators which have been removed
+	lock.Lock()
+	defer lock.Unlock()
+	for k := range resolutions {
+		if !keys[k] {
+			delete(resolutions, k)
+		}
+	}
+	return changed
+}
@@ -0,0 +1,131 @@
+package discovery
+
+import (
+	"context"
+	"fmt"
+	"math/big"
+	"net"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// maxHostBits bounds the size of the CIDR ranges, irrespective of the limit of the generator
+const maxHostBits = 16
+
+// rangePattern matches the numeric ranges of a pattern, e.g. [1-4] or [01-12]
+var rangePattern = regexp.MustCompile(`\[(\d+)-(\d+)\]`)
+
+// target is a server discovered by a generator
+type target struct {
+	address string
+	// port is the port of the SRV target, zero for the other modes
+	port int
+}
+
+func (t target) String() string {
+	if t.port != 0 {
+		return net.JoinHostPort(t.address, strconv.Itoa(t.port))
+	}
+	return t.address
+}
+
+// lookupSRV returns the targets of the SRV record name, e.g. _game._udp.example.com, in the order of
+// their priority & weight
+func lookupSRV(ctx context.Context, name string, _ int) ([]target, error) {
+	_, records, err := net.DefaultResolver.LookupSRV(ctx, "", "", name)
+	if err != nil {
+		return nil, err
+	}
+	targets := make([]target, len(records))
+	for i, record := range records {
+		targets[i] = target{address: strings.TrimSuffix(record.Target, "."), port: int(record.Port)}
+	}
+	return targets, nil
+}
+
+// lookupIPs returns every IPv4 & IPv6 address name resolves to
+func lookupIPs(ctx context.Context, name string, _ int) ([]target, error) {
+	addrs, err := net.DefaultResolver.LookupIPAddr(ctx, name)
+	if err != nil {
+		return nil, err
+	}
+	ips := make([]string, len(addrs))
+	for i, addr := range addrs {
+		ips[i] = addr.String()
+	}
+	// Keep the rows in a stable order, as the resolvers usually rotate the addresses
+	sort.Strings(ips)
+	targets := make([]target, len(ips))
+	for i, ip := range ips {
+		targets[i] = target{address: ip}
+	}
+	return targets, nil
+}
+
+// expandCIDR returns the hosts of the range, leaving out the network & broadcast addresses of the IPv4 ranges
+func expandCIDR(_ context.Context, cidr string, limit int) ([]target, error) {
+	_, network, err := net.ParseCIDR(cidr)
+	if err != nil {
+		return nil, err
+	}
+	ones, bits := network.Mask.Size()
+	hostBits := bits - ones
+	if hostBits > maxHostBits {
+		return nil, fmt.Errorf("%s is too large, the prefix must be at least /%d", cidr, bits-maxHostBits)
+	}
+	first, count := 0, 1<<hostBits
+	if bits == 8*net.IPv4len && hostBits > 1 {
+		first, count = 1, count-2
+	}
+	if count > limit {
+		return nil, fmt.Errorf("%s has %d hosts, more than the limit of %d", cidr, count, limit)
+	}
+	base := new(big.Int).SetBytes(network.IP)
+	targets := make([]target, count)
+	for i := range targets {
+		ip := new(big.Int).Add(base, big.NewInt(int64(first+i))).FillBytes(make([]byte, len(network.IP)))
+		targets[i] = target{address: net.IP(ip).String()}
+	}
+	return targets, nil
+}
+
+// expandPattern returns the names matching the numeric ranges of pattern, e.g. sgp-[1-4].valve.net expands
+// to sgp-1.valve.net up to sgp-4.valve.net. The numbers are zero padded as the start of their range, e.g. [01-12].
+func expandPattern(_ context.Context, pattern string, limit int) ([]target, error) {
+	ranges := rangePattern.FindAllStringSubmatchIndex(pattern, -1)
+	if len(ranges) == 0 {
+		return nil, fmt.Errorf("%q has no numeric range, e.g. [1-4]", pattern)
+	}
+	names := []string{""}
+	last := 0
+	for _, r := range ranges {
+		from, _ := strconv.Atoi(pattern[r[2]:r[3]])
+		to, _ := strconv.Atoi(pattern[r[4]:r[5]])
+		if from > to {
+			return nil, fmt.Errorf("invalid range %s in %q, the start is greater than the end", pattern[r[0]:r[1]], pattern)
+		}
+		if to-from >= limit || len(names)*(to-from+1) > limit {
+			return nil, fmt.Errorf("%q expands to more names than the limit of %d", pattern, limit)
+		}
+		width := 0
+		if start := pattern[r[2]:r[3]]; len(start) > 1 && start[0] == '0' {
+			width = len(start)
+		}
+		prefix := pattern[last:r[0]]
+		expanded := make([]string, 0, len(names)*(to-from+1))
+		for _, name := range names {
+			for n := from; n <= to; n++ {
+				expanded = append(expanded, fmt.Sprintf("%s%s%0*d", name, prefix, width, n))
+			}
+		}
+		names = expanded
+		last = r[1]
+	}
+	targets := make([]target, len(names))
+	for i, name := range names {
+		targets[i] = target{address: name + pattern[last:]}
+	}
+	return targets, nil
+}
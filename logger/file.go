@@ -4,6 +4,7 @@ import (
 	"fmt"
 	"github.com/soheltarir/ekko/config"
 	"os"
+	"path/filepath"
 )
 
 const (
@@ -13,10 +14,15 @@ const (
 )
 
 func setupFileLogDirectory() string {
-	if config.Config.Logging.FileLogsDirectory != "" {
-		return config.Config.Logging.FileLogsDirectory
+	if dir := config.Current().Logging.FileLogsDirectory; dir != "" {
+		return dir
 	} else {
 		currWd, _ := os.Getwd()
 		return fmt.Sprintf("%s/logs", currWd)
 	}
 }
+
+// ResultsFile returns the path of the file which the probe results are logged to
+func ResultsFile() string {
+	return filepath.Join(setupFileLogDirectory(), resultsLogName)
+}
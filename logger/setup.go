@@ -31,7 +31,7 @@ type logSetup struct {
 // init initialises some attributes of the setup object
 func (l logSetup) init() {
 	// Create the file logs directory if it doesn't exist
-	if !config.Config.Logging.FileEnabled {
+	if !config.Current().Logging.FileEnabled {
 		return
 	}
 	if _, err := os.Stat(l.logDir); os.IsNotExist(err) {
@@ -59,7 +59,7 @@ func (l logSetup) setupFileCore(logPath string, logLevels []zapcore.Level) zapco
 }
 
 func (l *logSetup) addFileDebugCore() {
-	if !config.Config.Logging.FileEnabled {
+	if !config.Current().Logging.FileEnabled {
 		return
 	}
 	path := fmt.Sprintf("%s/%s", l.logDir, debugLogName)
@@ -68,7 +68,7 @@ func (l *logSetup) addFileDebugCore() {
 }
 
 func (l *logSetup) addFileInfoCore() {
-	if !config.Config.Logging.FileEnabled {
+	if !config.Current().Logging.FileEnabled {
 		return
 	}
 	path := fmt.Sprintf("%s/%s", l.logDir, resultsLogName)
@@ -77,7 +77,7 @@ func (l *logSetup) addFileInfoCore() {
 }
 
 func (l *logSetup) addConsoleCore() {
-	if !config.Config.Logging.ConsoleEnabled {
+	if !config.Current().Logging.ConsoleEnabled {
 		return
 	}
 	encoder := zapcore.NewConsoleEncoder(Config)
@@ -93,7 +93,8 @@ func (l logSetup) finish() *zap.Logger {
 	return zap.New(core).WithOptions(zap.OnFatal(zapcore.WriteThenNoop))
 }
 
-var Log *zap.Logger
+// Log is the global logger, it discards everything until Setup is called
+var Log = zap.NewNop()
 
 // logPath contains the file location paths for different kind of logs being used
 type logPath struct {
@@ -104,7 +105,9 @@ type logPath struct {
 // LogPath is the global variable which stores log paths
 var LogPath = new(logPath)
 
-func init() {
+// Setup creates the global logger as per the logging configuration, hence it must be called
+// once the configuration is loaded
+func Setup() {
 	setup := newLogSetup(setupFileLogDirectory())
 	Log = setup.finish()
 }
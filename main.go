@@ -2,10 +2,17 @@ package main
 
 import (
 	"context"
+	"errors"
+	"github.com/soheltarir/ekko/api"
 	"github.com/soheltarir/ekko/config"
 	"github.com/soheltarir/ekko/consumer"
+	"github.com/soheltarir/ekko/discovery"
 	"github.com/soheltarir/ekko/logger"
+	"github.com/soheltarir/ekko/metrics"
+	"github.com/soheltarir/ekko/scheduler"
 	"github.com/soheltarir/ekko/ui"
+	"github.com/spf13/cobra"
+	"go.uber.org/zap"
 	"os"
 	"os/signal"
 	"sync"
@@ -13,7 +20,23 @@ import (
 )
 
 func main() {
+	if err := newRootCommand().Execute(); err != nil {
+		var status exitStatus
+		if errors.As(err, &status) {
+			os.Exit(int(status))
+		}
+		reportError(os.Stderr, err)
+		os.Exit(1)
+	}
+}
+
+// run monitors the servers until a shutdown signal is received, the targets given replace the configured servers
+func run(cmd *cobra.Command, targets []string) error {
+	if err := loadConfig(targets); err != nil {
+		return err
+	}
 	logger.Log.Info("Ekko service started")
+	logICMPMode()
 
 	// Set up cancellation context and wait group
 	ctx, cancelFunc := context.WithCancel(context.Background())
@@ -22,28 +45,73 @@ func main() {
 	// Create an event for UI changes
 	uiChan := make(chan ui.Event)
 
+	// create the consumer
+	pingConsumer := consumer.New(uiChan)
+
+	// Send the servers to ping as events to worker/s, as they are due. The scheduler is notified of the
+	// completed probes it dispatched, hence is registered before the workers are spawned.
+	producer := Producer{callbackFunc: pingConsumer.CallbackFunc}
+	probeScheduler := scheduler.New(producer.send)
+	pingConsumer.OnScheduledResult(probeScheduler.Done)
+
 	// Render UI and listen for updates
-	ekkoUI := ui.New(config.Config.Servers, uiChan)
+	ekkoUI := ui.New(config.Current().Servers, uiChan, probeScheduler)
 	go ekkoUI.Listen(ctx)
 
-	// create the consumer
-	pingConsumer := consumer.New(uiChan)
+	// Expose the results as Prometheus metrics, if enabled
+	var exporter *metrics.Exporter
+	if config.Current().Metrics.Enabled {
+		exporter = metrics.New(config.Current().Servers, pingConsumer)
+		pingConsumer.OnResult(exporter.Observe)
+		go exporter.Serve(ctx)
+	}
+
+	// Serve the live state over the JSON API, if enabled
+	if config.Current().API.Enabled {
+		history := api.NewHistory(config.Current().API.HistorySize)
+		pingConsumer.OnResult(history.Observe)
+		go api.New(history, pingConsumer).Serve(ctx)
+	}
 
 	// Start consumer with cancellation context passed
 	go pingConsumer.Start(ctx)
 
 	// Start workers and Add [workerPoolSize] to WaitGroup
-	wg.Add(config.Config.WorkerPoolSize)
-	for i := 0; i < config.Config.WorkerPoolSize; i++ {
-		go pingConsumer.SpawnWorker(i, wg)
+	pingConsumer.ScaleWorkers(config.Current().WorkerPoolSize, wg)
+
+	// Apply the reloaded configuration, stopping the export of the servers removed
+	reload := func() {
+		pingConsumer.Reload(wg)
+		if exporter != nil {
+			exporter.Prune(config.Current().Servers)
+		}
 	}
 
-	// Send the servers to ping as events to worker/s
-	producer := Producer{callbackFunc: pingConsumer.CallbackFunc}
-	go producer.Start(ctx)
+	// Apply the changes made to the configuration file while running
+	stopWatching := config.Watch(func() {
+		logger.Log.Info("Configuration reloaded")
+		reload()
+	}, func(err error) {
+		var restart config.RestartRequired
+		if errors.As(err, &restart) {
+			logger.Log.Warn("Settings changed which require a restart, keeping their previous values",
+				zap.Strings("settings", restart))
+			return
+		}
+		logger.Log.Error("Invalid configuration, keeping the previous one running", zap.Error(err))
+	})
+
+	// Resolve the generators of servers again as per their refresh interval
+	discovered := make(chan struct{})
+	go func() {
+		defer close(discovered)
+		discovery.Run(ctx, reload)
+	}()
+
+	go probeScheduler.Run(ctx)
 
 	// Handle sigterm and await termChan signal
-	termChan := make(chan os.Signal)
+	termChan := make(chan os.Signal, 1)
 	signal.Notify(termChan, syscall.SIGINT, syscall.SIGTERM, os.Interrupt)
 
 	<-termChan // Blocks here until interrupted
@@ -51,6 +119,10 @@ func main() {
 	// Handle shutdown
 	logger.Log.Warn("Shutdown signal received")
 	cancelFunc() // Signal cancellation to context.Context
-	wg.Wait()    // Block here until are workers are done
+	// Stop the reloads before waiting on the workers, as they may spawn new ones
+	stopWatching()
+	<-discovered
+	wg.Wait() // Block here until are workers are done
 	logger.Log.Debug("All workers stopped, shutting down")
+	return nil
 }
@@ -0,0 +1,246 @@
+// Package metrics exposes the probe results, and the state of the consumer workers as Prometheus metrics
+package metrics
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"github.com/soheltarir/ekko/config"
+	"github.com/soheltarir/ekko/logger"
+	"github.com/soheltarir/ekko/probe"
+	"go.uber.org/zap"
+	"net/http"
+	"reflect"
+	"sort"
+	"sync"
+	"time"
+)
+
+const namespace = "ekko"
+
+// serverLabels are the labels identifying a server in every probe metric, followed by the ones of config.Server.Labels
+var serverLabels = []string{"name", "address", "protocol"}
+
+// probeResults are the values of the result label of the probes_total metric
+var probeResults = []string{"success", "failure"}
+
+// WorkerPool exposes the state of the workers running the probes
+type WorkerPool interface {
+	// Workers returns the number of running workers
+	Workers() int
+	// BusyWorkers returns the number of workers currently running a probe
+	BusyWorkers() int
+	// QueueLength returns the number of probe events waiting for a free worker
+	QueueLength() int
+}
+
+// Exporter records the probe results as metrics, and serves them over HTTP
+type Exporter struct {
+	registry *prometheus.Registry
+	// labelKeys are the keys of config.Server.Labels across all the servers, exported as label_<key>. They are
+	// fixed once the metrics are registered, the keys added by a reload are only exported after a restart.
+	labelKeys []string
+
+	lock sync.Mutex
+	// series are the label values of the servers observed, keyed by the server name
+	series map[string][]string
+
+	rtt         *prometheus.HistogramVec
+	packetLoss  *prometheus.GaugeVec
+	probes      *prometheus.CounterVec
+	packetsSent *prometheus.CounterVec
+	packetsRecv *prometheus.CounterVec
+	pathMTU     *prometheus.GaugeVec
+	mtuChanges  *prometheus.CounterVec
+}
+
+// New creates an exporter for the servers, whose workers are observed through pool. The label keys of the
+// servers must map to distinct metric labels, as checked by the validation of the configuration.
+func New(servers []config.Server, pool WorkerPool) *Exporter {
+	e := &Exporter{registry: prometheus.NewRegistry(), series: make(map[string][]string)}
+
+	keys := make(map[string]bool)
+	for _, server := range servers {
+		for key := range server.Labels {
+			keys[key] = true
+		}
+	}
+	for key := range keys {
+		e.labelKeys = append(e.labelKeys, key)
+	}
+	sort.Strings(e.labelKeys)
+	labels := append([]string{}, serverLabels...)
+	for _, key := range e.labelKeys {
+		labels = append(labels, config.MetricLabel(key))
+	}
+
+	e.rtt = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "rtt_seconds",
+		Help:      "Round-trip time of the successful probe packets.",
+		Buckets:   []float64{.001, .0025, .005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5},
+	}, labels)
+	e.packetLoss = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "packet_loss_percent",
+		Help:      "Packet loss of the last probe run, in percent.",
+	}, labels)
+	e.probes = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "probes_total",
+		Help:      "Number of probe runs, by their result (success or failure).",
+	}, append(labels, "result"))
+	e.packetsSent = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "packets_sent_total",
+		Help:      "Number of probe packets sent.",
+	}, labels)
+	e.packetsRecv = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "packets_received_total",
+		Help:      "Number of probe packets which received a reply.",
+	}, labels)
+	e.pathMTU = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "path_mtu_bytes",
+		Help:      "Path MTU discovered by the last pmtu probe run, zero when not even the smallest packet passed.",
+	}, labels)
+	e.mtuChanges = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "path_mtu_changes_total",
+		Help:      "Number of times the path MTU discovered changed between two pmtu probe runs.",
+	}, labels)
+
+	e.registry.MustRegister(
+		e.rtt, e.packetLoss, e.probes, e.packetsSent, e.packetsRecv, e.pathMTU, e.mtuChanges,
+		prometheus.NewGaugeFunc(prometheus.GaugeOpts{
+			Namespace: namespace,
+			Name:      "workers",
+			Help:      "Number of running workers.",
+		}, func() float64 { return float64(pool.Workers()) }),
+		prometheus.NewGaugeFunc(prometheus.GaugeOpts{
+			Namespace: namespace,
+			Name:      "workers_busy",
+			Help:      "Number of workers currently running a probe.",
+		}, func() float64 { return float64(pool.BusyWorkers()) }),
+		prometheus.NewGaugeFunc(prometheus.GaugeOpts{
+			Namespace: namespace,
+			Name:      "queue_length",
+			Help:      "Number of probe events waiting for a free worker.",
+		}, func() float64 { return float64(pool.QueueLength()) }),
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+	)
+	return e
+}
+
+// labelValues returns the values of the labels identifying the server, in the order of their names
+func (e *Exporter) labelValues(server config.Server) []string {
+	values := []string{server.Name, server.Address, server.Protocol}
+	for _, key := range e.labelKeys {
+		value, ok := server.Labels[key]
+		if !ok {
+			values = append(values, "")
+			continue
+		}
+		values = append(values, fmt.Sprint(value))
+	}
+	return values
+}
+
+// Observe records the outcome of a probe run, it satisfies consumer.ResultHandler
+func (e *Exporter) Observe(server config.Server, result *probe.Result, err error) {
+	values := e.labelValues(server)
+	e.lock.Lock()
+	e.series[server.Name] = values
+	e.lock.Unlock()
+	if err != nil {
+		e.probes.WithLabelValues(append(values, "failure")...).Inc()
+		return
+	}
+	e.probes.WithLabelValues(append(values, "success")...).Inc()
+	e.packetLoss.WithLabelValues(values...).Set(result.PacketLoss)
+	e.packetsSent.WithLabelValues(values...).Add(float64(result.PacketsSent))
+	e.packetsRecv.WithLabelValues(values...).Add(float64(result.PacketsRecv))
+	histogram := e.rtt.WithLabelValues(values...)
+	for _, rtt := range result.Rtts {
+		histogram.Observe(rtt.Seconds())
+	}
+	if result.PMTU != nil {
+		e.pathMTU.WithLabelValues(values...).Set(float64(result.PMTU.MTU))
+		if result.PMTU.Changed() {
+			e.mtuChanges.WithLabelValues(values...).Inc()
+		}
+	}
+}
+
+// Prune deletes the series of the servers which aren't part of servers anymore, along with the ones whose
+// label values changed, so that they stop being exported. The label keys the servers didn't have when the
+// exporter was created are logged, as they aren't exported until a restart.
+func (e *Exporter) Prune(servers []config.Server) {
+	current := make(map[string][]string, len(servers))
+	added := make(map[string]bool)
+	for _, server := range servers {
+		current[server.Name] = e.labelValues(server)
+		for key := range server.Labels {
+			if i := sort.SearchStrings(e.labelKeys, key); i == len(e.labelKeys) || e.labelKeys[i] != key {
+				added[key] = true
+			}
+		}
+	}
+
+	e.lock.Lock()
+	defer e.lock.Unlock()
+	for name, values := range e.series {
+		if reflect.DeepEqual(current[name], values) {
+			continue
+		}
+		e.rtt.DeleteLabelValues(values...)
+		e.packetLoss.DeleteLabelValues(values...)
+		for _, result := range probeResults {
+			e.probes.DeleteLabelValues(append(values, result)...)
+		}
+		e.packetsSent.DeleteLabelValues(values...)
+		e.packetsRecv.DeleteLabelValues(values...)
+		e.pathMTU.DeleteLabelValues(values...)
+		e.mtuChanges.DeleteLabelValues(values...)
+		delete(e.series, name)
+	}
+
+	if len(added) > 0 {
+		keys := make([]string, 0, len(added))
+		for key := range added {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+		logger.Log.Warn("Server labels added which aren't exported as metrics until a restart",
+			zap.Strings("labels", keys))
+	}
+}
+
+// Serve exposes the metrics over HTTP until ctx is done
+func (e *Exporter) Serve(ctx context.Context) {
+	settings := config.Current().Metrics
+	mux := http.NewServeMux()
+	mux.Handle(settings.Path, promhttp.HandlerFor(e.registry, promhttp.HandlerOpts{}))
+	server := &http.Server{Addr: settings.Listen, Handler: mux}
+
+	go func() {
+		<-ctx.Done()
+		logger.Log.Warn("Received termination signal, stopping metrics server")
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		if err := server.Shutdown(shutdownCtx); err != nil {
+			logger.Log.Warn("Failed to gracefully stop metrics server", zap.Error(err))
+		}
+	}()
+
+	logger.Log.Info("Metrics server started",
+		zap.String("listen", settings.Listen), zap.String("path", settings.Path))
+	if err := server.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+		logger.Log.Error("Metrics server failed", zap.Error(err))
+	}
+}
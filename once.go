@@ -0,0 +1,208 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/soheltarir/ekko/api"
+	"github.com/soheltarir/ekko/config"
+	"github.com/soheltarir/ekko/consumer"
+	"github.com/soheltarir/ekko/logger"
+	"github.com/soheltarir/ekko/probe"
+	"github.com/soheltarir/ekko/ui"
+	"github.com/spf13/cobra"
+	"io"
+	"os"
+	"os/signal"
+	"strings"
+	"sync"
+	"syscall"
+	"text/tabwriter"
+	"time"
+)
+
+// ThresholdsExceeded is the exit status of the once command when a server exceeds the thresholds, or fails to be probed
+const ThresholdsExceeded = 2
+
+// Statuses of a server in the summary of the once command, from the best to the worst
+const (
+	StatusOK    = "ok"
+	StatusWarn  = "warn"
+	StatusError = "error"
+)
+
+// statusLevels orders the statuses, to compare them against the --fail-on flag
+var statusLevels = map[string]int{StatusOK: 0, StatusWarn: 1, StatusError: 2}
+
+// summaryRow is the outcome of probing a server once, along with its status against the thresholds
+type summaryRow struct {
+	Name    string `json:"name"`
+	Address string `json:"address"`
+	Status  string `json:"status"`
+	// Reasons explains why the status isn't ok
+	Reasons []string `json:"reasons,omitempty"`
+	api.Record
+}
+
+// newSummaryRow evaluates the outcome of probing server against the configured thresholds, result & err
+// are both nil when the probe was interrupted
+func newSummaryRow(server config.Server, result *probe.Result, err error) summaryRow {
+	row := summaryRow{Name: server.Name, Address: server.Address, Status: StatusOK}
+	if result == nil && err == nil {
+		err = errors.New("interrupted before completion")
+	}
+	row.Record = api.NewRecord(server, result, err)
+	if err != nil {
+		row.Status = StatusError
+		row.Reasons = []string{err.Error()}
+		return row
+	}
+
+	thresholds := config.Current().Thresholds
+	rtt := result.AvgRtt.Milliseconds()
+	switch {
+	case rtt > thresholds.Rtt.Error:
+		row.raise(StatusError, fmt.Sprintf("avg. response %dms above %dms", rtt, thresholds.Rtt.Error))
+	case rtt > thresholds.Rtt.Warn:
+		row.raise(StatusWarn, fmt.Sprintf("avg. response %dms above %dms", rtt, thresholds.Rtt.Warn))
+	}
+	switch {
+	case result.PacketLoss > thresholds.Loss.Error:
+		row.raise(StatusError, fmt.Sprintf("packet loss %.2f%% above %g%%", result.PacketLoss, thresholds.Loss.Error))
+	case result.PacketLoss > thresholds.Loss.Warn:
+		row.raise(StatusWarn, fmt.Sprintf("packet loss %.2f%% above %g%%", result.PacketLoss, thresholds.Loss.Warn))
+	}
+	return row
+}
+
+// raise sets the status of the row to status if it is worse, and records the reason
+func (r *summaryRow) raise(status, reason string) {
+	if statusLevels[status] > statusLevels[r.Status] {
+		r.Status = status
+	}
+	r.Reasons = append(r.Reasons, reason)
+}
+
+// summary is the outcome of the once command, with the servers in the order of the configuration
+type summary struct {
+	Passed  bool         `json:"passed"`
+	Servers []summaryRow `json:"servers"`
+}
+
+// newOnceCommand returns the command probing every server once
+func newOnceCommand() *cobra.Command {
+	var output, failOn string
+	cmd := &cobra.Command{
+		Use:   "once [targets...]",
+		Short: "Probe every server once, print the results and exit",
+		Long: "Probe every server once, print the results and exit.\n\n" +
+			"The command exits with status 2 when a server exceeds the thresholds of --fail-on level, or fails to be probed.",
+		Args: cobra.ArbitraryArgs,
+		RunE: func(cmd *cobra.Command, targets []string) error {
+			if output != "table" && output != "json" {
+				return fmt.Errorf("unsupported output %q, expected either table or json", output)
+			}
+			if failOn != StatusWarn && failOn != StatusError {
+				return fmt.Errorf("unsupported --fail-on level %q, expected either warn or error", failOn)
+			}
+			return once(targets, output, failOn)
+		},
+	}
+	cmd.Flags().StringVarP(&output, "output", "o", "table", "format of the summary, either table or json")
+	cmd.Flags().StringVar(&failOn, "fail-on", StatusError, "threshold level failing the run, either warn or error")
+	return cmd
+}
+
+// once probes every server a single time, and prints the summary once all of them are complete
+func once(targets []string, output, failOn string) error {
+	// The live table would be cleared as soon as the run is complete
+	config.Override("ui_enabled", false)
+	if err := loadConfig(targets); err != nil {
+		return err
+	}
+	logger.Log.Info("Ekko single run started")
+	logICMPMode()
+
+	ctx, cancelFunc := context.WithCancel(context.Background())
+	wg := &sync.WaitGroup{}
+	pingConsumer := consumer.New(make(chan ui.Event))
+
+	// Collect the summary of every server, keyed by its name
+	var lock sync.Mutex
+	rows := make(map[string]summaryRow)
+	pending := &sync.WaitGroup{}
+	pending.Add(len(config.Current().Servers))
+	pingConsumer.OnResult(func(dest config.Server, result *probe.Result, err error) {
+		lock.Lock()
+		rows[dest.Name] = newSummaryRow(dest, result, err)
+		lock.Unlock()
+		pending.Done()
+	})
+
+	go pingConsumer.Start(ctx)
+	pingConsumer.ScaleWorkers(config.Current().WorkerPoolSize, wg)
+	producer := Producer{callbackFunc: pingConsumer.CallbackFunc}
+	go producer.Round(ctx)
+
+	done := make(chan struct{})
+	go func() {
+		pending.Wait()
+		close(done)
+	}()
+	termChan := make(chan os.Signal, 1)
+	signal.Notify(termChan, syscall.SIGINT, syscall.SIGTERM, os.Interrupt)
+	select {
+	case <-done:
+	case <-termChan:
+		logger.Log.Warn("Shutdown signal received")
+	}
+	cancelFunc()
+	wg.Wait()
+
+	result := summary{Passed: true}
+	for _, server := range config.Current().Servers {
+		row, ok := rows[server.Name]
+		if !ok {
+			row = newSummaryRow(server, nil, nil)
+		}
+		if statusLevels[row.Status] >= statusLevels[failOn] {
+			result.Passed = false
+		}
+		result.Servers = append(result.Servers, row)
+	}
+	logger.Log.Info("Ekko single run complete")
+
+	var err error
+	if output == "json" {
+		encoder := json.NewEncoder(os.Stdout)
+		encoder.SetIndent("", "  ")
+		err = encoder.Encode(result)
+	} else {
+		err = printSummary(os.Stdout, result)
+	}
+	if err != nil {
+		return err
+	}
+	if !result.Passed {
+		return exitStatus(ThresholdsExceeded)
+	}
+	return nil
+}
+
+// printSummary writes the summary as a table
+func printSummary(w io.Writer, result summary) error {
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "NAME\tADDRESS\tSENT\tLOSS\tAVG\tMIN\tMAX\tMOS\tSTATUS\tREASONS")
+	for _, row := range result.Servers {
+		fmt.Fprintf(tw, "%s\t%s\t%d\t%.2f%%\t%s\t%s\t%s\t%.2f\t%s\t%s\n", row.Name, row.Address, row.PacketsSent,
+			row.PacketLoss, milliseconds(row.AvgRtt), milliseconds(row.MinRtt), milliseconds(row.MaxRtt), row.MOS,
+			strings.ToUpper(row.Status), strings.Join(row.Reasons, "; "))
+	}
+	return tw.Flush()
+}
+
+// milliseconds formats fractional milliseconds as a rounded duration
+func milliseconds(ms float64) string {
+	return time.Duration(ms * float64(time.Millisecond)).Round(time.Microsecond).String()
+}
@@ -0,0 +1,82 @@
+package probe
+
+import (
+	"context"
+	"fmt"
+	"github.com/soheltarir/ekko/config"
+	"go.uber.org/zap"
+	"net"
+	"time"
+)
+
+const (
+	// attemptInterval is the wait time between two consecutive attempts of a probe run
+	attemptInterval = time.Second
+	// attemptTimeout is the time after which a single attempt is considered as lost
+	attemptTimeout = 2 * time.Second
+)
+
+// attemptFunc performs a single attempt of a probe run, and returns its round-trip time
+type attemptFunc func(ctx context.Context, seq int) (time.Duration, error)
+
+// runAttempts calls attempt count times, spaced by attemptInterval, until ctx is done.
+// It returns the number of attempts made along with the round-trip times of the successful ones.
+func runAttempts(ctx context.Context, count int, log *zap.Logger, attempt attemptFunc) (int, []time.Duration) {
+	sent := 0
+	rtts := make([]time.Duration, 0, count)
+	for seq := 0; seq < count; seq++ {
+		if seq > 0 {
+			select {
+			case <-ctx.Done():
+				return sent, rtts
+			case <-time.After(attemptInterval):
+			}
+		}
+		sent++
+		rtt, err := attempt(ctx, seq)
+		if err != nil {
+			log.Debug("Probe attempt failed", zap.Int("seq", seq), zap.Error(err))
+			if ctx.Err() != nil {
+				return sent, rtts
+			}
+			continue
+		}
+		rtts = append(rtts, rtt)
+	}
+	return sent, rtts
+}
+
+// resolve looks up the address of the host once, so that name resolution isn't accounted in the probe timings.
+// The first address of the family is returned, see config.Server.IPFamily.
+func resolve(ctx context.Context, host, family string) (net.IP, error) {
+	addrs, err := net.DefaultResolver.LookupIPAddr(ctx, host)
+	if err != nil {
+		return nil, err
+	}
+	for _, addr := range addrs {
+		isV4 := addr.IP.To4() != nil
+		if family == "" || (family == config.IPv4) == isV4 {
+			return addr.IP, nil
+		}
+	}
+	return nil, fmt.Errorf("no %s address found for %s", ipVersion(family), host)
+}
+
+// ipVersion returns the name of the IP family, e.g. IPv6
+func ipVersion(family string) string {
+	if family == config.IPv6 {
+		return "IPv6"
+	}
+	return "IPv4"
+}
+
+// ipNetwork returns the network restricted to the IP family, e.g. ip6 or tcp4, when any
+func ipNetwork(network, family string) string {
+	switch family {
+	case config.IPv4:
+		return network + "4"
+	case config.IPv6:
+		return network + "6"
+	}
+	return network
+}
@@ -0,0 +1,252 @@
+package probe
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"github.com/soheltarir/ekko/config"
+	"go.uber.org/zap"
+	"golang.org/x/net/dns/dnsmessage"
+	"io"
+	"math/rand"
+	"net"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// DNS is the protocol name of the DNS resolution prober
+const DNS = "dns"
+
+// defaultDNSPort is used when the server doesn't specify the port of the resolver
+const defaultDNSPort = 53
+
+func init() {
+	Register(DNS, func(*History) Prober { return dnsProber{} })
+}
+
+// dnsTypes maps the record types which could be queried to their names in the configuration
+var dnsTypes = map[string]dnsmessage.Type{
+	"A":     dnsmessage.TypeA,
+	"AAAA":  dnsmessage.TypeAAAA,
+	"CNAME": dnsmessage.TypeCNAME,
+	"MX":    dnsmessage.TypeMX,
+	"NS":    dnsmessage.TypeNS,
+	"PTR":   dnsmessage.TypePTR,
+	"SOA":   dnsmessage.TypeSOA,
+	"SRV":   dnsmessage.TypeSRV,
+	"TXT":   dnsmessage.TypeTXT,
+}
+
+// rcodeNames contains the conventional names of the response codes
+var rcodeNames = map[dnsmessage.RCode]string{
+	dnsmessage.RCodeSuccess:        "NOERROR",
+	dnsmessage.RCodeFormatError:    "FORMERR",
+	dnsmessage.RCodeServerFailure:  "SERVFAIL",
+	dnsmessage.RCodeNameError:      "NXDOMAIN",
+	dnsmessage.RCodeNotImplemented: "NOTIMP",
+	dnsmessage.RCodeRefused:        "REFUSED",
+}
+
+func rcodeName(rcode dnsmessage.RCode) string {
+	if name, ok := rcodeNames[rcode]; ok {
+		return name
+	}
+	return strconv.Itoa(int(rcode))
+}
+
+// DNSAnswer describes the last response received from the resolver during a run
+type DNSAnswer struct {
+	// Rcode is the response code, e.g. NOERROR or NXDOMAIN
+	Rcode string
+	// Answers is the number of records in the answer section
+	Answers int
+}
+
+// Fields returns the answer as logging fields
+func (a *DNSAnswer) Fields() []zap.Field {
+	return []zap.Field{
+		zap.String("rcode", a.Rcode),
+		zap.Int("answers", a.Answers),
+	}
+}
+
+// dnsProber queries a record against the resolver configured as the server address.
+// Timed out queries and SERVFAIL responses are considered lost.
+type dnsProber struct{}
+
+func (dnsProber) Validate(dest config.Server) []config.Problem {
+	var problems []config.Problem
+	opts := dest.DNS
+	if _, ok := dnsTypes[strings.ToUpper(opts.Type)]; !ok {
+		problems = append(problems, config.Problem{Field: "dns.type", Message: fmt.Sprintf("unsupported record type %q", opts.Type)})
+	}
+	if opts.Name == "" {
+		problems = append(problems, config.Problem{Field: "dns.name", Message: "is required by the dns protocol"})
+	}
+	if network := strings.ToLower(opts.Transport); network != "udp" && network != "tcp" {
+		problems = append(problems, config.Problem{
+			Field: "dns.transport", Message: fmt.Sprintf("must be either udp or tcp, got %q", opts.Transport),
+		})
+	}
+	return problems
+}
+
+func (dnsProber) Probe(ctx context.Context, dest config.Server, log *zap.Logger) (*Result, error) {
+	opts := dest.DNS
+	qtype, ok := dnsTypes[strings.ToUpper(opts.Type)]
+	if !ok {
+		return nil, fmt.Errorf("unsupported record type %q", opts.Type)
+	}
+	if opts.Name == "" {
+		return nil, errors.New("dns probe requires the name to query")
+	}
+	fqdn := opts.Name
+	if !strings.HasSuffix(fqdn, ".") {
+		fqdn += "."
+	}
+	name, err := dnsmessage.NewName(fqdn)
+	if err != nil {
+		return nil, err
+	}
+	network := strings.ToLower(opts.Transport)
+	if network != "udp" && network != "tcp" {
+		return nil, fmt.Errorf("unsupported dns transport %q", opts.Transport)
+	}
+	ctx, cancel := context.WithTimeout(ctx, timeout(dest))
+	defer cancel()
+
+	m, err := newMarking(dest)
+	if err != nil {
+		return nil, err
+	}
+	ip, src, err := endpoints(ctx, dest)
+	if err != nil {
+		return nil, err
+	}
+	dialer := m.dialer(network, src)
+	port := dest.Port
+	if port == 0 {
+		port = defaultDNSPort
+	}
+	addr := net.JoinHostPort(ip.String(), strconv.Itoa(port))
+	question := dnsmessage.Question{Name: name, Type: qtype, Class: dnsmessage.ClassINET}
+
+	answer := &DNSAnswer{}
+	sent, rtts := runAttempts(ctx, packetCount(dest), log, func(ctx context.Context, seq int) (time.Duration, error) {
+		start := time.Now()
+		header, answers, err := dnsExchange(ctx, dialer, network, addr, question)
+		if err != nil {
+			return 0, err
+		}
+		rtt := time.Since(start)
+		answer.Rcode = rcodeName(header.RCode)
+		answer.Answers = answers
+		// NXDOMAIN is a valid answer of the resolver, hence isn't counted as lost, the rcode is reported instead
+		if header.RCode == dnsmessage.RCodeServerFailure {
+			return 0, errors.New("resolver responded with SERVFAIL")
+		}
+		return rtt, nil
+	})
+
+	result := NewResult(DNS, addr, sent, rtts)
+	if answer.Rcode != "" {
+		result.DNS = answer
+	}
+	return result, nil
+}
+
+// dnsExchange sends the question to the resolver over a connection of dialer, and waits for its response,
+// returning the header of the response and the number of records in its answer section.
+func dnsExchange(ctx context.Context, dialer net.Dialer, network, addr string, question dnsmessage.Question) (dnsmessage.Header, int, error) {
+	id := uint16(rand.Intn(1 << 16))
+	query := dnsmessage.Message{
+		Header:    dnsmessage.Header{ID: id, RecursionDesired: true},
+		Questions: []dnsmessage.Question{question},
+	}
+	packed, err := query.Pack()
+	if err != nil {
+		return dnsmessage.Header{}, 0, err
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, attemptTimeout)
+	defer cancel()
+	conn, err := dialer.DialContext(ctx, network, addr)
+	if err != nil {
+		return dnsmessage.Header{}, 0, err
+	}
+	defer conn.Close()
+	deadline, _ := ctx.Deadline()
+	if err := conn.SetDeadline(deadline); err != nil {
+		return dnsmessage.Header{}, 0, err
+	}
+
+	for {
+		var resp []byte
+		if network == "tcp" {
+			resp, err = dnsExchangeTCP(conn, packed)
+		} else {
+			resp, err = dnsExchangeUDP(conn, packed)
+		}
+		if err != nil {
+			return dnsmessage.Header{}, 0, err
+		}
+
+		var parser dnsmessage.Parser
+		header, err := parser.Start(resp)
+		if err != nil {
+			return dnsmessage.Header{}, 0, err
+		}
+		// Ignore the stray responses to the earlier queries
+		if header.ID != id || !header.Response {
+			if network == "tcp" {
+				return dnsmessage.Header{}, 0, errors.New("response doesn't match the query")
+			}
+			packed = nil
+			continue
+		}
+		if err := parser.SkipAllQuestions(); err != nil {
+			return dnsmessage.Header{}, 0, err
+		}
+		answers, err := parser.AllAnswers()
+		if err != nil {
+			return dnsmessage.Header{}, 0, err
+		}
+		return header, len(answers), nil
+	}
+}
+
+// dnsExchangeUDP writes the query as a single datagram, unless it is nil, and reads the next datagram
+func dnsExchangeUDP(conn net.Conn, query []byte) ([]byte, error) {
+	if query != nil {
+		if _, err := conn.Write(query); err != nil {
+			return nil, err
+		}
+	}
+	buf := make([]byte, maxDatagramSize)
+	n, err := conn.Read(buf)
+	if err != nil {
+		return nil, err
+	}
+	return buf[:n], nil
+}
+
+// dnsExchangeTCP writes the query prefixed by its length, and reads the response framed the same way
+func dnsExchangeTCP(conn net.Conn, query []byte) ([]byte, error) {
+	framed := make([]byte, 2+len(query))
+	binary.BigEndian.PutUint16(framed, uint16(len(query)))
+	copy(framed[2:], query)
+	if _, err := conn.Write(framed); err != nil {
+		return nil, err
+	}
+	var length [2]byte
+	if _, err := io.ReadFull(conn, length[:]); err != nil {
+		return nil, err
+	}
+	resp := make([]byte, binary.BigEndian.Uint16(length[:]))
+	if _, err := io.ReadFull(conn, resp); err != nil {
+		return nil, err
+	}
+	return resp, nil
+}
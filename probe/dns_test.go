@@ -0,0 +1,172 @@
+package probe
+
+import (
+	"context"
+	"encoding/binary"
+	"github.com/soheltarir/ekko/config"
+	"go.uber.org/zap"
+	"golang.org/x/net/dns/dnsmessage"
+	"io"
+	"net"
+	"testing"
+)
+
+// dnsResponder returns the responses of the stub to a query, in the order they are sent
+type dnsResponder func(query dnsmessage.Message) []dnsmessage.Message
+
+// reply responds to the query with the rcode, and an A record when the rcode is NOERROR
+func reply(rcode dnsmessage.RCode) dnsResponder {
+	return func(query dnsmessage.Message) []dnsmessage.Message {
+		return []dnsmessage.Message{response(query, query.Header.ID, rcode)}
+	}
+}
+
+// strayThenReply responds with a mismatched transaction ID first, followed by the actual response
+func strayThenReply(query dnsmessage.Message) []dnsmessage.Message {
+	return []dnsmessage.Message{
+		response(query, query.Header.ID+1, dnsmessage.RCodeSuccess),
+		response(query, query.Header.ID, dnsmessage.RCodeSuccess),
+	}
+}
+
+// stray only responds with a mismatched transaction ID
+func stray(query dnsmessage.Message) []dnsmessage.Message {
+	return []dnsmessage.Message{response(query, query.Header.ID+1, dnsmessage.RCodeSuccess)}
+}
+
+func response(query dnsmessage.Message, id uint16, rcode dnsmessage.RCode) dnsmessage.Message {
+	msg := dnsmessage.Message{
+		Header:    dnsmessage.Header{ID: id, Response: true, RCode: rcode},
+		Questions: query.Questions,
+	}
+	if rcode == dnsmessage.RCodeSuccess {
+		msg.Answers = []dnsmessage.Resource{{
+			Header: dnsmessage.ResourceHeader{Name: query.Questions[0].Name, Type: dnsmessage.TypeA, Class: dnsmessage.ClassINET},
+			Body:   &dnsmessage.AResource{A: [4]byte{127, 0, 0, 1}},
+		}}
+	}
+	return msg
+}
+
+// dnsStub serves the responses of respond over the network, either udp or tcp, and returns its port
+func dnsStub(t *testing.T, network string, respond dnsResponder) int {
+	t.Helper()
+	if network == "udp" {
+		conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+		if err != nil {
+			t.Fatalf("failed to listen, %v", err)
+		}
+		t.Cleanup(func() { conn.Close() })
+		go func() {
+			buf := make([]byte, maxDatagramSize)
+			for {
+				n, addr, err := conn.ReadFrom(buf)
+				if err != nil {
+					return
+				}
+				for _, packed := range respondTo(t, buf[:n], respond) {
+					conn.WriteTo(packed, addr)
+				}
+			}
+		}()
+		return conn.LocalAddr().(*net.UDPAddr).Port
+	}
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("failed to listen, %v", err)
+	}
+	t.Cleanup(func() { listener.Close() })
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer conn.Close()
+				var length [2]byte
+				if _, err := io.ReadFull(conn, length[:]); err != nil {
+					return
+				}
+				query := make([]byte, binary.BigEndian.Uint16(length[:]))
+				if _, err := io.ReadFull(conn, query); err != nil {
+					return
+				}
+				for _, packed := range respondTo(t, query, respond) {
+					framed := make([]byte, 2+len(packed))
+					binary.BigEndian.PutUint16(framed, uint16(len(packed)))
+					copy(framed[2:], packed)
+					conn.Write(framed)
+				}
+			}()
+		}
+	}()
+	return listener.Addr().(*net.TCPAddr).Port
+}
+
+// respondTo returns the packed responses to the packed query
+func respondTo(t *testing.T, packed []byte, respond dnsResponder) [][]byte {
+	var query dnsmessage.Message
+	if err := query.Unpack(packed); err != nil {
+		t.Errorf("failed to unpack the query, %v", err)
+		return nil
+	}
+	var responses [][]byte
+	for _, msg := range respond(query) {
+		packed, err := msg.Pack()
+		if err != nil {
+			t.Errorf("failed to pack the response, %v", err)
+			return nil
+		}
+		responses = append(responses, packed)
+	}
+	return responses
+}
+
+func TestDNSProbe(t *testing.T) {
+	tests := []struct {
+		name      string
+		transport string
+		respond   dnsResponder
+		recv      int
+		rcode     string
+		answers   int
+	}{
+		{"udp noerror", "udp", reply(dnsmessage.RCodeSuccess), 1, "NOERROR", 1},
+		{"udp servfail", "udp", reply(dnsmessage.RCodeServerFailure), 0, "SERVFAIL", 0},
+		{"udp nxdomain", "udp", reply(dnsmessage.RCodeNameError), 1, "NXDOMAIN", 0},
+		{"udp stray response ignored", "udp", strayThenReply, 1, "NOERROR", 1},
+		{"tcp noerror", "tcp", reply(dnsmessage.RCodeSuccess), 1, "NOERROR", 1},
+		{"tcp servfail", "tcp", reply(dnsmessage.RCodeServerFailure), 0, "SERVFAIL", 0},
+		{"tcp nxdomain", "tcp", reply(dnsmessage.RCodeNameError), 1, "NXDOMAIN", 0},
+		{"tcp mismatched response", "tcp", stray, 0, "", 0},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			dest := config.Server{
+				Name: "dns", Address: "127.0.0.1", Protocol: DNS, Port: dnsStub(t, tt.transport, tt.respond),
+				MinPacketNum: 1, MaxPacketNum: 1, PingTimeout: 10,
+				DNS: config.DNSOptions{Name: "ekko.example", Type: "A", Transport: tt.transport},
+			}
+			result, err := dnsProber{}.Probe(context.Background(), dest, zap.NewNop())
+			if err != nil {
+				t.Fatalf("Probe() failed, %v", err)
+			}
+			if result.PacketsSent != 1 || result.PacketsRecv != tt.recv {
+				t.Errorf("sent %d, received %d, want 1, %d", result.PacketsSent, result.PacketsRecv, tt.recv)
+			}
+			if tt.rcode == "" {
+				if result.DNS != nil {
+					t.Errorf("answer %+v, want none", result.DNS)
+				}
+				return
+			}
+			if result.DNS == nil || result.DNS.Rcode != tt.rcode || result.DNS.Answers != tt.answers {
+				t.Errorf("answer %+v, want %s with %d answers", result.DNS, tt.rcode, tt.answers)
+			}
+		})
+	}
+}
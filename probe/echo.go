@@ -0,0 +1,202 @@
+package probe
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"golang.org/x/net/icmp"
+	"golang.org/x/net/ipv4"
+	"golang.org/x/net/ipv6"
+	"math/rand"
+	"net"
+	"syscall"
+	"time"
+)
+
+// protocolICMPv6 is the IANA protocol number of ICMP for IPv6
+const protocolICMPv6 = 58
+
+// fragmentationNeeded is the error of the echo requests dropped for exceeding the MTU of the path, while
+// their don't fragment flag is set
+type fragmentationNeeded struct {
+	// from is the router which responded with "fragmentation needed", nil when the request exceeds the MTU
+	// of the local interface, or the one the kernel learnt for the path
+	from net.IP
+	// mtu is the next-hop MTU reported by the router, zero when unknown
+	mtu int
+}
+
+func (e *fragmentationNeeded) Error() string {
+	if e.from == nil {
+		return "fragmentation needed, the request exceeds the local MTU"
+	}
+	if e.mtu == 0 {
+		return fmt.Sprintf("fragmentation needed, reported by %s", e.from)
+	}
+	return fmt.Sprintf("fragmentation needed, reported by %s with a next-hop MTU of %d", e.from, e.mtu)
+}
+
+// echoer sends ICMP echo requests with the marking go-ping can't set, i.e. the TOS & DF bit, over a
+// raw socket when privileged, a datagram socket otherwise
+type echoer struct {
+	conn       net.PacketConn
+	dst        net.Addr
+	v6         bool
+	privileged bool
+	// id identifies the echo requests of the echoer, the kernel overwrites it on datagram sockets
+	id int
+	// buf holds the messages read
+	buf []byte
+}
+
+// newEchoer opens the socket sending the echo requests to dst from src, when set
+func newEchoer(ctx context.Context, dst, src net.IP, m marking) (*echoer, error) {
+	e := &echoer{v6: dst.To4() == nil, privileged: ICMPMode() == Privileged, id: rand.Intn(1 << 16),
+		buf: make([]byte, maxDatagramSize)}
+	var err error
+	if e.privileged {
+		network, address := "ip4:icmp", ""
+		if e.v6 {
+			network = "ip6:ipv6-icmp"
+		}
+		if src != nil {
+			address = src.String()
+		}
+		lc := net.ListenConfig{Control: m.control}
+		e.conn, err = lc.ListenPacket(ctx, network, address)
+		e.dst = &net.IPAddr{IP: dst}
+	} else {
+		e.conn, err = listenICMPDatagram(e.v6, src, m)
+		e.dst = &net.UDPAddr{IP: dst}
+	}
+	if err != nil {
+		return nil, err
+	}
+	return e, nil
+}
+
+// Close closes the socket of the echoer
+func (e *echoer) Close() error {
+	return e.conn.Close()
+}
+
+// echo sends an echo request with a payload of size bytes, and waits for its reply until attemptTimeout
+// elapses or ctx is done. It returns the round-trip time, or a *fragmentationNeeded error when the request
+// exceeds the MTU of the path.
+func (e *echoer) echo(ctx context.Context, seq, size int) (time.Duration, error) {
+	var typ icmp.Type = ipv4.ICMPTypeEcho
+	if e.v6 {
+		typ = ipv6.ICMPTypeEchoRequest
+	}
+	seq &= 0xffff
+	msg := icmp.Message{Type: typ, Body: &icmp.Echo{ID: e.id, Seq: seq, Data: make([]byte, size)}}
+	// The kernel computes the checksum of ICMPv6, hence the pseudo header is omitted
+	packet, err := msg.Marshal(nil)
+	if err != nil {
+		return 0, err
+	}
+
+	deadline := time.Now().Add(attemptTimeout)
+	if d, ok := ctx.Deadline(); ok && d.Before(deadline) {
+		deadline = d
+	}
+	if err := e.conn.SetReadDeadline(deadline); err != nil {
+		return 0, err
+	}
+	// Unblock the pending read as soon as the probe gets cancelled
+	done := make(chan struct{})
+	defer close(done)
+	go func() {
+		select {
+		case <-ctx.Done():
+			e.conn.SetReadDeadline(time.Now())
+		case <-done:
+		}
+	}()
+
+	start := time.Now()
+	if _, err := e.conn.WriteTo(packet, e.dst); err != nil {
+		if errors.Is(err, syscall.EMSGSIZE) {
+			return 0, &fragmentationNeeded{}
+		}
+		return 0, err
+	}
+	for {
+		n, peer, err := e.conn.ReadFrom(e.buf)
+		if err != nil {
+			if errors.Is(err, syscall.EMSGSIZE) {
+				return 0, &fragmentationNeeded{}
+			}
+			return 0, err
+		}
+		reply, err := e.parse(e.buf[:n])
+		if err != nil {
+			continue
+		}
+		switch body := reply.Body.(type) {
+		case *icmp.Echo:
+			if (reply.Type == ipv4.ICMPTypeEchoReply || reply.Type == ipv6.ICMPTypeEchoReply) &&
+				e.matches(body.ID, body.Seq, seq) && sameIP(peer, e.dst) {
+				return time.Since(start), nil
+			}
+		case *icmp.DstUnreach:
+			// Code 4 is "fragmentation needed and DF set", along with the MTU in the last 2 bytes of the header
+			if reply.Code == 4 && e.quotes(body.Data, seq) {
+				return 0, &fragmentationNeeded{from: addrIP(peer), mtu: int(binary.BigEndian.Uint16(e.buf[6:8]))}
+			}
+		case *icmp.PacketTooBig:
+			if e.quotes(body.Data, seq) {
+				return 0, &fragmentationNeeded{from: addrIP(peer), mtu: body.MTU}
+			}
+		}
+	}
+}
+
+// parse parses the ICMP message read
+func (e *echoer) parse(b []byte) (*icmp.Message, error) {
+	if e.v6 {
+		return icmp.ParseMessage(protocolICMPv6, b)
+	}
+	return icmp.ParseMessage(protocolICMP, b)
+}
+
+// matches reports whether the identifiers of a message are the ones of the request seq. The identifier is
+// set by the kernel on datagram sockets, which only deliver the messages of the socket.
+func (e *echoer) matches(id, seq, want int) bool {
+	return seq == want && (!e.privileged || id == e.id)
+}
+
+// quotes reports whether the ICMP error quotes the request seq, i.e. its data starts with the IP header
+// of the request followed by its ICMP header
+func (e *echoer) quotes(data []byte, seq int) bool {
+	headerLen := ipv6.HeaderLen
+	if !e.v6 {
+		if len(data) < ipv4.HeaderLen {
+			return false
+		}
+		headerLen = int(data[0]&0x0f) << 2
+	}
+	if len(data) < headerLen+8 {
+		return false
+	}
+	request := data[headerLen:]
+	id := int(binary.BigEndian.Uint16(request[4:6]))
+	return e.matches(id, int(binary.BigEndian.Uint16(request[6:8])), seq)
+}
+
+// sameIP reports whether both addresses have the same IP
+func sameIP(a, b net.Addr) bool {
+	return addrIP(a).Equal(addrIP(b))
+}
+
+// addrIP returns the IP of the address of an ICMP socket
+func addrIP(addr net.Addr) net.IP {
+	switch a := addr.(type) {
+	case *net.IPAddr:
+		return a.IP
+	case *net.UDPAddr:
+		return a.IP
+	}
+	return nil
+}
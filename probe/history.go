@@ -0,0 +1,76 @@
+package probe
+
+import (
+	"fmt"
+	"github.com/soheltarir/ekko/config"
+	"strings"
+	"sync"
+)
+
+// History keeps the state of the destinations across their probe runs, e.g. the hops of the traced ones or the
+// MTU discovered towards the others, keyed by the server name. It is owned by the caller running the probes,
+// which prunes the destinations removed.
+type History struct {
+	lock sync.Mutex
+	// hops are the hops of every traced destination
+	hops map[string][]Hop
+	// mtus are the path MTUs last discovered towards every destination
+	mtus map[string]int
+	// targets are the targets the state of every destination was recorded for, see target
+	targets map[string]string
+}
+
+// NewHistory returns an empty history
+func NewHistory() *History {
+	return &History{hops: make(map[string][]Hop), mtus: make(map[string]int), targets: make(map[string]string)}
+}
+
+// target identifies what the state of dest was recorded for, the state of a server whose target changes
+// doesn't apply anymore
+func target(dest config.Server) string {
+	return fmt.Sprintf("%s://%s:%d %s %s", strings.ToLower(dest.Protocol), dest.Address, dest.Port, dest.Source,
+		dest.IPFamily)
+}
+
+// Prune forgets the destinations which aren't part of servers anymore, along with the ones whose target changed
+func (h *History) Prune(servers []config.Server) {
+	h.lock.Lock()
+	defer h.lock.Unlock()
+	targets := make(map[string]string, len(servers))
+	for _, server := range servers {
+		targets[server.Name] = target(server)
+	}
+	for name, recorded := range h.targets {
+		if targets[name] != recorded {
+			h.forget(name)
+		}
+	}
+}
+
+// forget drops the state of the destination, the lock must be held
+func (h *History) forget(name string) {
+	delete(h.hops, name)
+	delete(h.mtus, name)
+	delete(h.targets, name)
+}
+
+// recordMTU keeps the MTU discovered towards dest, and returns the previous one
+func (h *History) recordMTU(dest config.Server, mtu int) int {
+	h.lock.Lock()
+	defer h.lock.Unlock()
+	h.track(dest)
+	previous := h.mtus[dest.Name]
+	if mtu != 0 {
+		h.mtus[dest.Name] = mtu
+	}
+	return previous
+}
+
+// track resets the state of dest when its target changed since it was recorded, the lock must be held
+func (h *History) track(dest config.Server) {
+	t := target(dest)
+	if recorded, ok := h.targets[dest.Name]; ok && recorded != t {
+		h.forget(dest.Name)
+	}
+	h.targets[dest.Name] = t
+}
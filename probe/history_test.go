@@ -0,0 +1,46 @@
+package probe
+
+import (
+	"github.com/soheltarir/ekko/config"
+	"net"
+	"testing"
+)
+
+func TestHistoryPrune(t *testing.T) {
+	kept := config.Server{Name: "kept", Address: "192.0.2.1", Protocol: Trace}
+	moved := config.Server{Name: "moved", Address: "192.0.2.2", Protocol: Trace}
+	removed := config.Server{Name: "removed", Address: "192.0.2.3", Protocol: Trace}
+	history := NewHistory()
+	for _, dest := range []config.Server{kept, moved, removed} {
+		history.updateHops(dest, map[int]*traceReply{1: {ttl: 1, from: net.ParseIP(dest.Address), final: true}}, 30)
+	}
+	moved.Address = "192.0.2.4"
+	history.Prune([]config.Server{kept, moved})
+	for name, want := range map[string]int{"kept": 1, "moved": 0, "removed": 0} {
+		if got := len(history.hops[name]); got != want {
+			t.Errorf("%s has %d hops, want %d", name, got, want)
+		}
+	}
+}
+
+func TestHistoryRecordMTU(t *testing.T) {
+	dest := config.Server{Name: "pmtu", Address: "192.0.2.1", Protocol: PMTU}
+	history := NewHistory()
+	steps := []struct {
+		name     string
+		address  string
+		mtu      int
+		previous int
+	}{
+		{"first run", "192.0.2.1", 1500, 0},
+		{"nothing discovered", "192.0.2.1", 0, 1500},
+		{"mtu lowered", "192.0.2.1", 1400, 1500},
+		{"address changed", "192.0.2.2", 1500, 0},
+	}
+	for _, step := range steps {
+		dest.Address = step.address
+		if got := history.recordMTU(dest, step.mtu); got != step.previous {
+			t.Errorf("%s: recordMTU() = %d, want %d", step.name, got, step.previous)
+		}
+	}
+}
@@ -0,0 +1,219 @@
+package probe
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"fmt"
+	"github.com/soheltarir/ekko/config"
+	"go.uber.org/zap"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptrace"
+	"strings"
+	"time"
+)
+
+// HTTP is the protocol name of the HTTP(S) request prober
+const HTTP = "http"
+
+const (
+	// httpAttemptTimeout is the time after which a single HTTP request is considered as lost
+	httpAttemptTimeout = 10 * time.Second
+	// maxBodySize is the maximum number of bytes of the response body which are read
+	maxBodySize = 1 << 20
+)
+
+func init() {
+	Register(HTTP, func(*History) Prober { return httpProber{} })
+}
+
+// HTTPTiming is the breakdown of an HTTP request into its phases, averaged over the successful requests of a run
+type HTTPTiming struct {
+	// DNSLookup is the time taken to resolve the host
+	DNSLookup time.Duration
+	// TCPConnect is the time taken to establish the TCP connection
+	TCPConnect time.Duration
+	// TLSHandshake is the time taken by the TLS handshake, zero for plain HTTP
+	TLSHandshake time.Duration
+	// TTFB is the time between the request being written and the first byte of the response
+	TTFB time.Duration
+	// Total is the time taken by the whole request, including reading the response body
+	Total time.Duration
+	// StatusCode is the status code of the last response received, including the ones failing the assertions
+	StatusCode int
+}
+
+// Fields returns the timings as logging fields
+func (t *HTTPTiming) Fields() []zap.Field {
+	return []zap.Field{
+		zap.Duration("dns_lookup", t.DNSLookup),
+		zap.Duration("tcp_connect", t.TCPConnect),
+		zap.Duration("tls_handshake", t.TLSHandshake),
+		zap.Duration("ttfb", t.TTFB),
+		zap.Duration("total_time", t.Total),
+		zap.Int("status_code", t.StatusCode),
+	}
+}
+
+// add accumulates the timings of a single request
+func (t *HTTPTiming) add(other HTTPTiming) {
+	t.DNSLookup += other.DNSLookup
+	t.TCPConnect += other.TCPConnect
+	t.TLSHandshake += other.TLSHandshake
+	t.TTFB += other.TTFB
+	t.Total += other.Total
+}
+
+// average divides the accumulated timings by the number of requests
+func (t *HTTPTiming) average(n int) {
+	if n == 0 {
+		return
+	}
+	d := time.Duration(n)
+	t.DNSLookup /= d
+	t.TCPConnect /= d
+	t.TLSHandshake /= d
+	t.TTFB /= d
+	t.Total /= d
+}
+
+// httpProber sends HTTP requests to the destination URL, tracing the time spent in each phase
+type httpProber struct{}
+
+func (httpProber) Validate(dest config.Server) []config.Problem {
+	var problems []config.Problem
+	if !strings.Contains(dest.Address, "://") {
+		problems = append(problems, config.Problem{
+			Field: "address", Message: fmt.Sprintf("must be a URL for the http protocol, got %q", dest.Address),
+		})
+	} else if _, err := http.NewRequest(dest.HTTP.Method, dest.Address, nil); err != nil {
+		problems = append(problems, config.Problem{Field: "address", Message: err.Error()})
+	}
+	for i, status := range dest.HTTP.ExpectedStatus {
+		if status < 100 || status > 599 {
+			problems = append(problems, config.Problem{
+				Field: fmt.Sprintf("http.expected_status[%d]", i), Message: fmt.Sprintf("invalid status code %d", status),
+			})
+		}
+	}
+	return problems
+}
+
+func (httpProber) Probe(ctx context.Context, dest config.Server, log *zap.Logger) (*Result, error) {
+	opts := dest.HTTP
+	if !strings.Contains(dest.Address, "://") {
+		return nil, fmt.Errorf("http probe requires a URL as address, got %q", dest.Address)
+	}
+	// Validate the request once, so that a malformed URL fails the whole probe
+	if _, err := http.NewRequest(opts.Method, dest.Address, nil); err != nil {
+		return nil, err
+	}
+	ctx, cancel := context.WithTimeout(ctx, timeout(dest))
+	defer cancel()
+
+	m, err := newMarking(dest)
+	if err != nil {
+		return nil, err
+	}
+	src, family, err := source(dest)
+	if err != nil {
+		return nil, err
+	}
+	client := &http.Client{
+		Transport: &http.Transport{
+			// Every request opens a new connection, so that all the phases are measured
+			DisableKeepAlives: true,
+			DialContext: func(ctx context.Context, network, addr string) (net.Conn, error) {
+				dialer := m.dialer(network, src)
+				return dialer.DialContext(ctx, ipNetwork(network, family), addr)
+			},
+			TLSClientConfig: &tls.Config{InsecureSkipVerify: opts.InsecureSkipVerify},
+		},
+		// Redirects aren't followed, the timings are of the configured URL only
+		CheckRedirect: func(*http.Request, []*http.Request) error {
+			return http.ErrUseLastResponse
+		},
+	}
+
+	var total HTTPTiming
+	sent, rtts := runAttempts(ctx, packetCount(dest), log, func(ctx context.Context, seq int) (time.Duration, error) {
+		timing, err := httpRequest(ctx, client, dest)
+		if timing.StatusCode != 0 {
+			total.StatusCode = timing.StatusCode
+		}
+		if err != nil {
+			return 0, err
+		}
+		total.add(timing)
+		return timing.Total, nil
+	})
+	total.average(len(rtts))
+
+	result := NewResult(HTTP, dest.Address, sent, rtts)
+	result.HTTP = &total
+	return result, nil
+}
+
+// httpRequest performs a single request to the destination and asserts its response
+func httpRequest(ctx context.Context, client *http.Client, dest config.Server) (HTTPTiming, error) {
+	var timing HTTPTiming
+	var dnsStart, connectStart, tlsStart, wrote time.Time
+	trace := &httptrace.ClientTrace{
+		DNSStart:          func(httptrace.DNSStartInfo) { dnsStart = time.Now() },
+		DNSDone:           func(httptrace.DNSDoneInfo) { timing.DNSLookup = time.Since(dnsStart) },
+		ConnectStart:      func(string, string) { connectStart = time.Now() },
+		ConnectDone:       func(string, string, error) { timing.TCPConnect = time.Since(connectStart) },
+		TLSHandshakeStart: func() { tlsStart = time.Now() },
+		TLSHandshakeDone: func(tls.ConnectionState, error) {
+			timing.TLSHandshake = time.Since(tlsStart)
+		},
+		WroteRequest:         func(httptrace.WroteRequestInfo) { wrote = time.Now() },
+		GotFirstResponseByte: func() { timing.TTFB = time.Since(wrote) },
+	}
+
+	ctx, cancel := context.WithTimeout(httptrace.WithClientTrace(ctx, trace), httpAttemptTimeout)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, dest.HTTP.Method, dest.Address, nil)
+	if err != nil {
+		return timing, err
+	}
+	for name, value := range dest.HTTP.Headers {
+		req.Header.Set(name, value)
+	}
+
+	start := time.Now()
+	resp, err := client.Do(req)
+	if err != nil {
+		return timing, err
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(io.LimitReader(resp.Body, maxBodySize))
+	if err != nil {
+		return timing, err
+	}
+	timing.Total = time.Since(start)
+	timing.StatusCode = resp.StatusCode
+
+	if !expectedStatus(dest.HTTP.ExpectedStatus, resp.StatusCode) {
+		return timing, fmt.Errorf("unexpected status code %d", resp.StatusCode)
+	}
+	if dest.HTTP.BodyContains != "" && !bytes.Contains(body, []byte(dest.HTTP.BodyContains)) {
+		return timing, fmt.Errorf("response body doesn't contain %q", dest.HTTP.BodyContains)
+	}
+	return timing, nil
+}
+
+// expectedStatus checks the status code against the expected ones, any status below 400 is expected by default
+func expectedStatus(expected []int, code int) bool {
+	if len(expected) == 0 {
+		return code < http.StatusBadRequest
+	}
+	for _, status := range expected {
+		if status == code {
+			return true
+		}
+	}
+	return false
+}
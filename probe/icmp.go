@@ -0,0 +1,112 @@
+package probe
+
+import (
+	"context"
+	"fmt"
+	"github.com/go-ping/ping"
+	"github.com/soheltarir/ekko/config"
+	"go.uber.org/zap"
+	"time"
+)
+
+func init() {
+	Register(ICMP, func(*History) Prober { return icmpProber{} })
+}
+
+// icmpProber sends ICMP echo requests to the destination
+type icmpProber struct{}
+
+// minICMPSize is the smallest payload go-ping accepts, as it carries its timestamp & tracker in it
+const minICMPSize = 24
+
+func (icmpProber) Validate(dest config.Server) []config.Problem {
+	if dest.PacketSize > 0 && dest.PacketSize < minICMPSize {
+		return []config.Problem{{
+			Field: "packet_size", Message: fmt.Sprintf("must be at least %d bytes, got %d", minICMPSize, dest.PacketSize),
+		}}
+	}
+	return nil
+}
+
+func (icmpProber) Probe(ctx context.Context, dest config.Server, log *zap.Logger) (*Result, error) {
+	m, err := newMarking(dest)
+	if err != nil {
+		return nil, err
+	}
+	if m.socketOptions() {
+		return probeEcho(ctx, dest, m, log)
+	}
+	src, family, err := source(dest)
+	if err != nil {
+		return nil, err
+	}
+	pinger := ping.New(dest.Address)
+	pinger.SetNetwork(ipNetwork("ip", family))
+	if err := pinger.Resolve(); err != nil {
+		return nil, err
+	}
+	if src != nil {
+		pinger.Source = src.String()
+	}
+
+	// Randomize the count of packets to be sent
+	pinger.Count = packetCount(dest)
+
+	// Set the timeout for a packet to consider it as failed
+	pinger.Timeout = timeout(dest)
+
+	if dest.PacketSize > 0 {
+		pinger.Size = dest.PacketSize
+	}
+	if dest.TTL > 0 {
+		pinger.TTL = dest.TTL
+	}
+
+	// Override the default logger
+	pinger.SetLogger(log.Sugar())
+
+	// Use raw sockets when privileged, otherwise the datagram ICMP sockets
+	pinger.SetPrivileged(ICMPMode() == Privileged)
+
+	// Stop the pinger as soon as the probe gets cancelled
+	done := make(chan struct{})
+	defer close(done)
+	go func() {
+		select {
+		case <-ctx.Done():
+			pinger.Stop()
+		case <-done:
+		}
+	}()
+
+	if err := pinger.Run(); err != nil {
+		return nil, err
+	}
+	s := pinger.Statistics()
+	return NewResult(ICMP, s.Addr, s.PacketsSent, s.Rtts), nil
+}
+
+// probeEcho sends the echo requests through an echoer rather than go-ping, as it can't set the TOS & DF bit
+func probeEcho(ctx context.Context, dest config.Server, m marking, log *zap.Logger) (*Result, error) {
+	ctx, cancel := context.WithTimeout(ctx, timeout(dest))
+	defer cancel()
+
+	dst, src, err := endpoints(ctx, dest)
+	if err != nil {
+		return nil, err
+	}
+	e, err := newEchoer(ctx, dst, src, m)
+	if err != nil {
+		return nil, err
+	}
+	defer e.Close()
+
+	size := dest.PacketSize
+	if size == 0 {
+		size = minICMPSize
+	}
+	sent, rtts := runAttempts(ctx, packetCount(dest), log, func(ctx context.Context, seq int) (time.Duration, error) {
+		return e.echo(ctx, seq, size)
+	})
+	return NewResult(ICMP, dst.String(), sent, rtts), nil
+}
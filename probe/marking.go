@@ -0,0 +1,63 @@
+package probe
+
+import (
+	"github.com/soheltarir/ekko/config"
+	"net"
+	"strings"
+	"syscall"
+)
+
+// marking holds the IP header settings of the packets sent to a server
+type marking struct {
+	ttl int
+	// tos is the type of service byte, i.e. the DSCP followed by the ECN bits which are left unset
+	tos          int
+	dontFragment bool
+	// ignorePathMTU sends the packets exceeding the MTU the kernel learnt for the path along with the DF bit,
+	// so that every one of them reaches the router dropping it, as required by the path MTU discovery
+	ignorePathMTU bool
+}
+
+// newMarking returns the marking of the packets sent to dest
+func newMarking(dest config.Server) (marking, error) {
+	dscp, err := config.ParseDSCP(dest.DSCP)
+	if err != nil {
+		return marking{}, err
+	}
+	return marking{ttl: dest.TTL, tos: dscp << 2, dontFragment: !dest.Fragmentable()}, nil
+}
+
+// socketOptions reports whether the marking requires setting options on the socket, as the TOS & DF bit can't
+// be set through go-ping
+func (m marking) socketOptions() bool {
+	return m.tos != 0 || m.dontFragment
+}
+
+// control sets the marking on the socket before it connects, it suits net.Dialer & net.ListenConfig
+func (m marking) control(network, address string, c syscall.RawConn) error {
+	var err error
+	if controlErr := c.Control(func(fd uintptr) {
+		err = m.apply(fd, isIPv6(network, address))
+	}); controlErr != nil {
+		return controlErr
+	}
+	return err
+}
+
+// isIPv6 reports whether the socket of network towards address is an IPv6 one
+func isIPv6(network, address string) bool {
+	if strings.HasSuffix(network, "6") || strings.HasPrefix(network, "ip6") {
+		return true
+	}
+	host, _, err := net.SplitHostPort(address)
+	if err != nil {
+		host = address
+	}
+	ip := net.ParseIP(host)
+	return ip != nil && ip.To4() == nil
+}
+
+// dialer returns a dialer of network bound to src, when set, which marks the packets of its connections
+func (m marking) dialer(network string, src net.IP) net.Dialer {
+	return net.Dialer{LocalAddr: localAddr(network, src), Control: m.control}
+}
@@ -0,0 +1,108 @@
+package probe
+
+import (
+	"context"
+	"fmt"
+	"github.com/soheltarir/ekko/config"
+	"math/rand"
+	"net"
+	"strings"
+	"time"
+)
+
+func init() {
+	rand.Seed(time.Now().UnixNano())
+}
+
+// packetCount returns a randomised number of packets to be sent in a single probe run of dest
+func packetCount(dest config.Server) int {
+	if dest.MaxPacketNum <= dest.MinPacketNum {
+		return dest.MinPacketNum
+	}
+	return rand.Intn(dest.MaxPacketNum-dest.MinPacketNum) + dest.MinPacketNum
+}
+
+// timeout returns the duration after which a probe run of dest is considered as failed
+func timeout(dest config.Server) time.Duration {
+	return dest.Timeout()
+}
+
+// sourceAddress returns the IP address to send the probes from, source being either an IP address or
+// the name of an interface, in which case its first address of the family is used, IPv4 being preferred
+// when the family is omitted
+func sourceAddress(source, family string) (net.IP, error) {
+	if ip := net.ParseIP(source); ip != nil {
+		return ip, nil
+	}
+	iface, err := net.InterfaceByName(source)
+	if err != nil {
+		return nil, fmt.Errorf("invalid source %q, %w", source, err)
+	}
+	addrs, err := iface.Addrs()
+	if err != nil {
+		return nil, err
+	}
+	var fallback net.IP
+	for _, addr := range addrs {
+		ipNet, ok := addr.(*net.IPNet)
+		if !ok {
+			continue
+		}
+		if ipFamily(ipNet.IP) == family || (family == "" && ipNet.IP.To4() != nil) {
+			return ipNet.IP, nil
+		}
+		if family == "" && fallback == nil {
+			fallback = ipNet.IP
+		}
+	}
+	if fallback != nil {
+		return fallback, nil
+	}
+	return nil, fmt.Errorf("no %s address found on interface %s", ipVersion(family), source)
+}
+
+// ipFamily returns the family of the IP address, see config.Server.IPFamily
+func ipFamily(ip net.IP) string {
+	if ip.To4() != nil {
+		return config.IPv4
+	}
+	return config.IPv6
+}
+
+// source returns the source address dest is probed from, which is nil when the source isn't set, along
+// with the family its address must be resolved within: the one of the source, unless the server is
+// restricted to a family
+func source(dest config.Server) (net.IP, string, error) {
+	if dest.Source == "" {
+		return nil, dest.IPFamily, nil
+	}
+	src, err := sourceAddress(dest.Source, dest.IPFamily)
+	if err != nil {
+		return nil, "", err
+	}
+	if dest.IPFamily == "" {
+		return src, ipFamily(src), nil
+	}
+	return src, dest.IPFamily, nil
+}
+
+// endpoints resolves the address of dest, along with the source address it is probed from, see source
+func endpoints(ctx context.Context, dest config.Server) (dst, src net.IP, err error) {
+	src, family, err := source(dest)
+	if err != nil {
+		return nil, nil, err
+	}
+	dst, err = resolve(ctx, dest.Address, family)
+	return dst, src, err
+}
+
+// localAddr returns the local address of the sockets of network bound to src, nil when src is
+func localAddr(network string, src net.IP) net.Addr {
+	if src == nil {
+		return nil
+	}
+	if strings.HasPrefix(network, "udp") {
+		return &net.UDPAddr{IP: src}
+	}
+	return &net.TCPAddr{IP: src}
+}
@@ -0,0 +1,263 @@
+package probe
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/soheltarir/ekko/config"
+	"go.uber.org/zap"
+	"golang.org/x/net/ipv4"
+	"golang.org/x/net/ipv6"
+	"math/bits"
+	"net"
+	"time"
+)
+
+// PMTU is the protocol name of the path MTU discovery prober
+const PMTU = "pmtu"
+
+const (
+	// minIPv4MTU & minIPv6MTU are the smallest MTUs every link supports, the search starts from them
+	minIPv4MTU = 68
+	minIPv6MTU = 1280
+	// maxMTU is the largest packet IP allows
+	maxMTU = 65535
+	// icmpHeaderLen is the size of the header of an ICMP echo request, preceding its payload
+	icmpHeaderLen = 8
+	// mtuStepTimeout is the time after which an echo request of the search is considered as lost
+	mtuStepTimeout = time.Second
+	// mtuRetries is the number of times a lost echo request is sent again, before its size is deemed too large
+	mtuRetries = 1
+)
+
+func init() {
+	Register(PMTU, func(history *History) Prober { return pmtuProber{history: history} })
+}
+
+// PathMTU is the outcome of the path MTU discovery towards a destination
+type PathMTU struct {
+	// MTU is the size of the largest packet, IP header included, which reached the destination with the DF bit
+	// set, zero when not even the smallest one did
+	MTU int
+	// Previous is the MTU discovered by the previous run, zero on the first one
+	Previous int
+	// FragmentationNeeded is the number of "fragmentation needed" responses received from the routers on the path
+	FragmentationNeeded int
+	// ReportedMTU is the lowest next-hop MTU in those responses, along with the router which reported it
+	ReportedMTU int
+	ReportedBy  string
+}
+
+// Changed reports whether the MTU differs from the one discovered by the previous run
+func (p PathMTU) Changed() bool {
+	return p.Previous != 0 && p.MTU != 0 && p.MTU != p.Previous
+}
+
+// Fields returns the outcome of the discovery as logging fields
+func (p PathMTU) Fields() []zap.Field {
+	fields := []zap.Field{zap.Int("path_mtu", p.MTU), zap.Int("fragmentation_needed", p.FragmentationNeeded)}
+	if p.ReportedBy != "" {
+		fields = append(fields, zap.Int("reported_mtu", p.ReportedMTU), zap.String("reported_by", p.ReportedBy))
+	}
+	return fields
+}
+
+// pmtuProber binary-searches the largest ICMP echo request reaching the destination with the DF bit set, then
+// measures the round-trip times of echo requests of that size. The MTU discovered is kept in its history.
+type pmtuProber struct {
+	history *History
+}
+
+// Validate checks the maximum MTU against the minimum of every IP family the server is probed over
+func (pmtuProber) Validate(dest config.Server) []config.Problem {
+	limit := dest.PMTU.MaxMTU
+	for _, family := range mtuFamilies(dest) {
+		if minimum := minMTU(family); limit < minimum || limit > maxMTU {
+			return []config.Problem{{
+				Field:   "pmtu.max_mtu",
+				Message: fmt.Sprintf("must be between %d and %d bytes over %s, got %d", minimum, maxMTU, ipVersion(family), limit),
+			}}
+		}
+	}
+	return nil
+}
+
+// mtuFamilies returns the IP families the discovery towards dest runs over, the ones with the largest minimum
+// MTU first. The family of the address resolved first is unknown beforehand, hence IPv4 is assumed for it.
+func mtuFamilies(dest config.Server) []string {
+	family := dest.IPFamily
+	if ip := net.ParseIP(dest.Address); ip != nil {
+		// The servers are probed over the family of their IP only, see config.BothIPs
+		family = ipFamily(ip)
+	}
+	switch family {
+	case config.BothIPs:
+		return []string{config.IPv6, config.IPv4}
+	case config.IPv6:
+		return []string{config.IPv6}
+	}
+	return []string{config.IPv4}
+}
+
+// minMTU returns the smallest MTU of the IP family
+func minMTU(family string) int {
+	if family == config.IPv6 {
+		return minIPv6MTU
+	}
+	return minIPv4MTU
+}
+
+// runTimeout returns the duration a run of the discovery may last: the search, every echo request of which
+// may be lost, followed by count echo requests of the MTU found. It is never shorter than the ping timeout.
+func runTimeout(dest config.Server, minimum, count int) time.Duration {
+	// The limit & the minimum are tried first, then the range in between is halved at every step
+	steps := 2 + bits.Len(uint(dest.PMTU.MaxMTU-minimum))
+	search := time.Duration(steps*(mtuRetries+1)) * mtuStepTimeout
+	attempts := time.Duration(count)*attemptTimeout + time.Duration(count-1)*attemptInterval
+	if run := search + attempts; run > timeout(dest) {
+		return run
+	}
+	return timeout(dest)
+}
+
+func (p pmtuProber) Probe(ctx context.Context, dest config.Server, log *zap.Logger) (*Result, error) {
+	m, err := newMarking(dest)
+	if err != nil {
+		return nil, err
+	}
+	m.dontFragment, m.ignorePathMTU = true, true
+
+	resolveCtx, cancel := context.WithTimeout(ctx, timeout(dest))
+	dst, src, err := endpoints(resolveCtx, dest)
+	cancel()
+	if err != nil {
+		return nil, err
+	}
+	s := &mtuSearch{headerLen: ipv4.HeaderLen, minMTU: minMTU(ipFamily(dst)), log: log}
+	if dst.To4() == nil {
+		s.headerLen = ipv6.HeaderLen
+	}
+	if dest.PMTU.MaxMTU < s.minMTU {
+		return nil, fmt.Errorf("the maximum MTU %d is below the minimum of %s, %d", dest.PMTU.MaxMTU, ipVersion(ipFamily(dst)), s.minMTU)
+	}
+	// The run may outlast the ping timeout, as the search takes a step per halving of the range of MTUs
+	count := packetCount(dest)
+	limit := runTimeout(dest, s.minMTU, count)
+	ctx, cancel = context.WithTimeout(ctx, limit)
+	defer cancel()
+
+	if s.echoer, err = newEchoer(ctx, dst, src, m); err != nil {
+		return nil, err
+	}
+	defer s.Close()
+
+	mtu, err := s.run(ctx, dest.PMTU.MaxMTU)
+	if err != nil {
+		return nil, fmt.Errorf("path MTU discovery didn't complete within %s, %w", limit, err)
+	}
+	found := s.found
+	found.MTU = mtu
+	found.Previous = p.history.recordMTU(dest, mtu)
+
+	var result *Result
+	if mtu == 0 {
+		result = NewResult(PMTU, dst.String(), 1, nil)
+	} else {
+		sent, rtts := runAttempts(ctx, count, log, func(ctx context.Context, seq int) (time.Duration, error) {
+			return s.echo(ctx, s.next(), mtu-s.headerLen-icmpHeaderLen)
+		})
+		if ctx.Err() != nil {
+			return nil, fmt.Errorf("path MTU probe didn't complete within %s, %d of %d echo requests sent, %w",
+				limit, sent, count, ctx.Err())
+		}
+		result = NewResult(PMTU, dst.String(), sent, rtts)
+	}
+	result.PMTU = &found
+	return result, nil
+}
+
+// mtuSearch looks for the largest MTU towards the destination of its echoer
+type mtuSearch struct {
+	*echoer
+	// headerLen is the size of the IP header of the echo requests, which accounts in the MTU
+	headerLen int
+	minMTU    int
+	seq       int
+	found     PathMTU
+	log       *zap.Logger
+}
+
+// next returns the sequence number of the next echo request
+func (s *mtuSearch) next() int {
+	s.seq++
+	return s.seq
+}
+
+// run returns the largest MTU up to limit which reaches the destination, trying limit first as it passes on
+// most paths. It returns zero when not even the smallest MTU does.
+func (s *mtuSearch) run(ctx context.Context, limit int) (int, error) {
+	fits, err := s.fits(ctx, limit)
+	if fits || err != nil {
+		return limit, err
+	}
+	if fits, err = s.fits(ctx, s.minMTU); !fits || err != nil {
+		return 0, err
+	}
+	// lo always fits, while anything above hi doesn't
+	lo, hi := s.minMTU, limit-1
+	if s.found.ReportedMTU >= lo && s.found.ReportedMTU < hi {
+		hi = s.found.ReportedMTU
+	}
+	for lo < hi {
+		mid := (lo + hi + 1) / 2
+		fits, err := s.fits(ctx, mid)
+		if err != nil {
+			return 0, err
+		}
+		if fits {
+			lo = mid
+			continue
+		}
+		hi = mid - 1
+		// A router reporting its next-hop MTU narrows the search down further
+		if s.found.ReportedMTU >= lo && s.found.ReportedMTU < hi {
+			hi = s.found.ReportedMTU
+		}
+	}
+	return lo, nil
+}
+
+// fits reports whether an echo request of the MTU reaches the destination, it is sent again when lost, as
+// loss can't be told apart from a router dropping the request silently
+func (s *mtuSearch) fits(ctx context.Context, mtu int) (bool, error) {
+	for try := 0; try <= mtuRetries; try++ {
+		stepCtx, cancel := context.WithTimeout(ctx, mtuStepTimeout)
+		_, err := s.echo(stepCtx, s.next(), mtu-s.headerLen-icmpHeaderLen)
+		cancel()
+		if err == nil {
+			return true, nil
+		}
+		if ctx.Err() != nil {
+			return false, ctx.Err()
+		}
+		var tooBig *fragmentationNeeded
+		if errors.As(err, &tooBig) {
+			s.fragmentationNeeded(tooBig)
+			return false, nil
+		}
+		s.log.Debug("Path MTU probe lost", zap.Int("mtu", mtu), zap.Error(err))
+	}
+	return false, nil
+}
+
+// fragmentationNeeded accounts a "fragmentation needed" response, the ones caused by the local MTU aren't
+func (s *mtuSearch) fragmentationNeeded(err *fragmentationNeeded) {
+	s.log.Debug("Path MTU probe too large", zap.Error(err))
+	if err.from == nil {
+		return
+	}
+	s.found.FragmentationNeeded++
+	if err.mtu != 0 && (s.found.ReportedMTU == 0 || err.mtu < s.found.ReportedMTU) {
+		s.found.ReportedMTU, s.found.ReportedBy = err.mtu, err.from.String()
+	}
+}
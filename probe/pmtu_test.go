@@ -0,0 +1,76 @@
+package probe
+
+import (
+	"github.com/soheltarir/ekko/config"
+	"testing"
+	"time"
+)
+
+// pmtuServerConfig returns a server discovering the path MTU towards address over family, up to maxMTU
+func pmtuServerConfig(address, family string, maxMTU int) config.Server {
+	return config.Server{
+		Name:         "pmtu",
+		Address:      address,
+		Protocol:     PMTU,
+		IPFamily:     family,
+		PingTimeout:  30,
+		MinPacketNum: 5,
+		MaxPacketNum: 5,
+		PMTU:         config.PMTUOptions{MaxMTU: maxMTU},
+	}
+}
+
+func TestPMTUValidate(t *testing.T) {
+	tests := []struct {
+		name    string
+		dest    config.Server
+		invalid bool
+	}{
+		{"ipv4 above its minimum", pmtuServerConfig("example.com", config.IPv4, 576), false},
+		{"ipv4 below its minimum", pmtuServerConfig("example.com", config.IPv4, 60), true},
+		{"ipv6 below its minimum", pmtuServerConfig("example.com", config.IPv6, 576), true},
+		{"both below the ipv6 minimum", pmtuServerConfig("example.com", config.BothIPs, 576), true},
+		{"both above the ipv6 minimum", pmtuServerConfig("example.com", config.BothIPs, 1500), false},
+		{"both over an ipv4 address", pmtuServerConfig("192.0.2.1", config.BothIPs, 576), false},
+		{"both over an ipv6 address", pmtuServerConfig("2001:db8::1", config.BothIPs, 576), true},
+		{"first address resolved", pmtuServerConfig("example.com", "", 576), false},
+		{"above the largest packet", pmtuServerConfig("example.com", config.IPv4, 65536), true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			problems := pmtuProber{}.Validate(tt.dest)
+			if invalid := len(problems) > 0; invalid != tt.invalid {
+				t.Fatalf("Validate() = %v, want invalid %t", problems, tt.invalid)
+			}
+			for _, problem := range problems {
+				if problem.Field != "pmtu.max_mtu" {
+					t.Errorf("problem with %s, want pmtu.max_mtu", problem.Field)
+				}
+			}
+		})
+	}
+}
+
+func TestPMTURunTimeout(t *testing.T) {
+	tests := []struct {
+		name  string
+		dest  config.Server
+		min   int
+		count int
+		want  time.Duration
+	}{
+		// 2 + 11 steps of 2s, then 5 attempts of 2s spaced by 1s
+		{"ipv4 default", pmtuServerConfig("example.com", config.IPv4, 1500), minIPv4MTU, 5, 40 * time.Second},
+		// 2 + 8 steps of 2s, then 5 attempts of 2s spaced by 1s
+		{"ipv6 default", pmtuServerConfig("example.com", config.IPv6, 1500), minIPv6MTU, 5, 34 * time.Second},
+		// Shorter than the ping timeout
+		{"smallest range", pmtuServerConfig("example.com", config.IPv6, 1280), minIPv6MTU, 1, 30 * time.Second},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := runTimeout(tt.dest, tt.min, tt.count); got != tt.want {
+				t.Errorf("runTimeout() = %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,62 @@
+package probe
+
+import (
+	"fmt"
+	"github.com/soheltarir/ekko/config"
+	"golang.org/x/net/icmp"
+	"strings"
+	"sync"
+)
+
+// The ICMP privilege modes of config.Current().ICMPPrivilege
+const (
+	// AutoPrivilege selects the privileged mode when raw sockets can be opened, the unprivileged one otherwise
+	AutoPrivilege = "auto"
+	// Privileged sends the ICMP echo requests over raw sockets, which requires root or CAP_NET_RAW
+	Privileged = "privileged"
+	// Unprivileged sends the ICMP echo requests over datagram sockets, which requires the group of the user
+	// to be allowed by the net.ipv4.ping_group_range sysctl on Linux
+	Unprivileged = "unprivileged"
+)
+
+var icmpModes = struct {
+	sync.Mutex
+	// selected maps the privilege setting to the mode it selected, so that auto is detected once
+	selected map[string]string
+}{selected: make(map[string]string)}
+
+// ICMPMode returns the mode the ICMP sockets are opened in, either Privileged or Unprivileged, as per
+// the icmp_privilege setting
+func ICMPMode() string {
+	setting := strings.ToLower(config.Current().ICMPPrivilege)
+	icmpModes.Lock()
+	defer icmpModes.Unlock()
+	if mode, ok := icmpModes.selected[setting]; ok {
+		return mode
+	}
+	mode := setting
+	if setting != Privileged && setting != Unprivileged {
+		mode = Unprivileged
+		if CheckICMPMode(Privileged) == nil {
+			mode = Privileged
+		}
+	}
+	icmpModes.selected[setting] = mode
+	return mode
+}
+
+// CheckICMPMode opens an ICMP socket in the mode, and returns why it can't be opened
+func CheckICMPMode(mode string) error {
+	network := "udp4"
+	if mode == Privileged {
+		network = "ip4:icmp"
+	}
+	conn, err := icmp.ListenPacket(network, "0.0.0.0")
+	if err != nil {
+		if mode == Privileged {
+			return fmt.Errorf("raw ICMP sockets require root or the CAP_NET_RAW capability, %w", err)
+		}
+		return fmt.Errorf("datagram ICMP sockets require the group of the user to be within net.ipv4.ping_group_range, %w", err)
+	}
+	return conn.Close()
+}
@@ -0,0 +1,126 @@
+package probe
+
+import (
+	"context"
+	"fmt"
+	"github.com/soheltarir/ekko/config"
+	"github.com/soheltarir/ekko/stats"
+	"go.uber.org/zap"
+	"strings"
+	"time"
+)
+
+// ICMP is the protocol name of the default prober, used when a server doesn't specify one
+const ICMP = "icmp"
+
+// Result is the normalised outcome of probing a destination, irrespective of the protocol used
+type Result struct {
+	// Protocol is the name of the prober which produced the result
+	Protocol string
+	// Addr is the address which was probed
+	Addr string
+	// PacketsSent is the number of probes (packets, connections, requests...) attempted
+	PacketsSent int
+	// PacketsRecv is the number of probes which received a successful reply
+	PacketsRecv int
+	// PacketLoss is the percentage of probes which failed
+	PacketLoss float64
+	// Rtts contains the round-trip time of every successful probe
+	Rtts      []time.Duration
+	MinRtt    time.Duration
+	MaxRtt    time.Duration
+	AvgRtt    time.Duration
+	StdDevRtt time.Duration
+	// Jitter is the RFC 3550 interarrival jitter of the round-trip times
+	Jitter time.Duration
+	P50Rtt time.Duration
+	P90Rtt time.Duration
+	P99Rtt time.Duration
+	// RFactor & MOS estimate the call quality over the path, see stats.MOS
+	RFactor float64
+	MOS     float64
+	// HTTP contains the phase timings, when the result is of an HTTP probe
+	HTTP *HTTPTiming
+	// DNS describes the last response, when the result is of a DNS probe
+	DNS *DNSAnswer
+	// Hops contains the rolling statistics of every hop on the path, when the result is of a trace probe
+	Hops []Hop
+	// PMTU contains the outcome of the path MTU discovery, when the result is of a pmtu probe
+	PMTU *PathMTU
+}
+
+// NewResult builds a Result out of the number of probes sent and the round-trip times of the successful ones
+func NewResult(protocol, addr string, sent int, rtts []time.Duration) *Result {
+	result := &Result{
+		Protocol:    protocol,
+		Addr:        addr,
+		PacketsSent: sent,
+		PacketsRecv: len(rtts),
+		Rtts:        rtts,
+	}
+	if sent == 0 {
+		return result
+	}
+	result.PacketLoss = float64(sent-len(rtts)) / float64(sent) * 100
+	summary := stats.Summarise(rtts)
+	result.MinRtt = summary.Min
+	result.MaxRtt = summary.Max
+	result.AvgRtt = summary.Avg
+	result.StdDevRtt = summary.StdDev
+	result.Jitter = summary.Jitter
+	result.P50Rtt = summary.P50
+	result.P90Rtt = summary.P90
+	result.P99Rtt = summary.P99
+	result.RFactor, result.MOS = stats.MOS(summary.Avg, summary.Jitter, result.PacketLoss)
+	return result
+}
+
+// Prober is implemented by every strategy capable of measuring the latency & loss towards a destination.
+// Probe must return once the measurement is complete, or as soon as ctx is cancelled.
+type Prober interface {
+	Probe(ctx context.Context, dest config.Server, log *zap.Logger) (*Result, error)
+}
+
+// Validator is implemented by the probers requiring specific server settings, so that the problems
+// with them are reported as soon as the configuration is loaded, rather than on every probe run
+type Validator interface {
+	Validate(dest config.Server) []config.Problem
+}
+
+func init() {
+	config.RegisterServerValidator(validate)
+}
+
+// validate checks that the protocol of the server is supported, along with the settings of its prober
+func validate(dest config.Server) []config.Problem {
+	prober, err := New(dest.Protocol, nil)
+	if err != nil {
+		return []config.Problem{{Field: "protocol", Message: err.Error()}}
+	}
+	if validator, ok := prober.(Validator); ok {
+		return validator.Validate(dest)
+	}
+	return nil
+}
+
+// registry maps a protocol name to the constructor of its prober
+var registry = make(map[string]func(history *History) Prober)
+
+// Register makes a prober available for servers configured with the given protocol. The probers keeping
+// state across the runs of a destination keep it in the history they are constructed with.
+func Register(protocol string, factory func(history *History) Prober) {
+	registry[strings.ToLower(protocol)] = factory
+}
+
+// New returns the prober registered for the given protocol, defaulting to ICMP when it is empty. The history
+// may be nil when the prober is only used to validate the servers.
+func New(protocol string, history *History) (Prober, error) {
+	if protocol == "" {
+		protocol = ICMP
+	}
+	factory, ok := registry[strings.ToLower(protocol)]
+	if !ok {
+		return nil, fmt.Errorf("unsupported protocol %q", protocol)
+	}
+	return factory(history), nil
+}
@@ -0,0 +1,77 @@
+package probe
+
+import (
+	"fmt"
+	"net"
+	"os"
+	"syscall"
+)
+
+// apply sets the marking on the socket fd
+func (m marking) apply(fd uintptr, v6 bool) error {
+	s := int(fd)
+	level, tos, ttl, mtuDiscover := syscall.IPPROTO_IP, syscall.IP_TOS, syscall.IP_TTL, syscall.IP_MTU_DISCOVER
+	dontFragment, ignorePathMTU := syscall.IP_PMTUDISC_DO, syscall.IP_PMTUDISC_PROBE
+	if v6 {
+		level, tos, ttl, mtuDiscover = syscall.IPPROTO_IPV6, syscall.IPV6_TCLASS, syscall.IPV6_UNICAST_HOPS, syscall.IPV6_MTU_DISCOVER
+		dontFragment, ignorePathMTU = syscall.IPV6_PMTUDISC_DO, syscall.IPV6_PMTUDISC_PROBE
+	}
+	if m.tos != 0 {
+		if err := syscall.SetsockoptInt(s, level, tos, m.tos); err != nil {
+			return os.NewSyscallError("setsockopt", err)
+		}
+	}
+	if m.ttl != 0 {
+		if err := syscall.SetsockoptInt(s, level, ttl, m.ttl); err != nil {
+			return os.NewSyscallError("setsockopt", err)
+		}
+	}
+	if m.dontFragment {
+		if m.ignorePathMTU {
+			dontFragment = ignorePathMTU
+		}
+		if err := syscall.SetsockoptInt(s, level, mtuDiscover, dontFragment); err != nil {
+			return os.NewSyscallError("setsockopt", err)
+		}
+	}
+	return nil
+}
+
+// listenICMPDatagram opens a datagram ICMP socket bound to src, which doesn't require privileges as long as
+// the group of the user is within net.ipv4.ping_group_range. The marking is set on the socket.
+func listenICMPDatagram(v6 bool, src net.IP, m marking) (net.PacketConn, error) {
+	family, proto, sa := syscall.AF_INET, syscall.IPPROTO_ICMP, syscall.Sockaddr(&syscall.SockaddrInet4{})
+	if v6 {
+		family, proto, sa = syscall.AF_INET6, syscall.IPPROTO_ICMPV6, &syscall.SockaddrInet6{}
+	}
+	if src != nil {
+		if v6 {
+			addr := &syscall.SockaddrInet6{}
+			copy(addr.Addr[:], src.To16())
+			sa = addr
+		} else {
+			addr := &syscall.SockaddrInet4{}
+			copy(addr.Addr[:], src.To4())
+			sa = addr
+		}
+	}
+	s, err := syscall.Socket(family, syscall.SOCK_DGRAM|syscall.SOCK_CLOEXEC, proto)
+	if err != nil {
+		return nil, os.NewSyscallError("socket", err)
+	}
+	if err := m.apply(uintptr(s), v6); err != nil {
+		syscall.Close(s)
+		return nil, err
+	}
+	if err := syscall.Bind(s, sa); err != nil {
+		syscall.Close(s)
+		return nil, os.NewSyscallError("bind", err)
+	}
+	f := os.NewFile(uintptr(s), "icmp")
+	defer f.Close()
+	conn, err := net.FilePacketConn(f)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open the ICMP socket, %w", err)
+	}
+	return conn, nil
+}
@@ -0,0 +1,23 @@
+//go:build !linux
+// +build !linux
+
+package probe
+
+import (
+	"fmt"
+	"net"
+	"runtime"
+)
+
+// apply sets the marking on the socket fd, which is only supported on Linux
+func (m marking) apply(_ uintptr, _ bool) error {
+	if m == (marking{}) {
+		return nil
+	}
+	return fmt.Errorf("the ttl, dscp & dont_fragment settings aren't supported on %s", runtime.GOOS)
+}
+
+// listenICMPDatagram opens a datagram ICMP socket, which is only supported on Linux
+func listenICMPDatagram(_ bool, _ net.IP, _ marking) (net.PacketConn, error) {
+	return nil, fmt.Errorf("unprivileged ICMP sockets with the dscp & dont_fragment settings aren't supported on %s", runtime.GOOS)
+}
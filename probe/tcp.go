@@ -0,0 +1,59 @@
+package probe
+
+import (
+	"context"
+	"errors"
+	"github.com/soheltarir/ekko/config"
+	"go.uber.org/zap"
+	"net"
+	"strconv"
+	"time"
+)
+
+// TCP is the protocol name of the TCP connect prober
+const TCP = "tcp"
+
+func init() {
+	Register(TCP, func(*History) Prober { return tcpProber{} })
+}
+
+// tcpProber measures the time taken to complete a TCP handshake with the destination
+type tcpProber struct{}
+
+func (tcpProber) Validate(dest config.Server) []config.Problem {
+	if dest.Port == 0 && !dest.DiscoversPort() {
+		return []config.Problem{{Field: "port", Message: "is required by the tcp protocol"}}
+	}
+	return nil
+}
+
+func (tcpProber) Probe(ctx context.Context, dest config.Server, log *zap.Logger) (*Result, error) {
+	if dest.Port == 0 {
+		return nil, errors.New("tcp probe requires a port")
+	}
+	ctx, cancel := context.WithTimeout(ctx, timeout(dest))
+	defer cancel()
+
+	m, err := newMarking(dest)
+	if err != nil {
+		return nil, err
+	}
+	ip, src, err := endpoints(ctx, dest)
+	if err != nil {
+		return nil, err
+	}
+	addr := net.JoinHostPort(ip.String(), strconv.Itoa(dest.Port))
+
+	dialer := m.dialer("tcp", src)
+	dialer.Timeout = attemptTimeout
+	sent, rtts := runAttempts(ctx, packetCount(dest), log, func(ctx context.Context, seq int) (time.Duration, error) {
+		start := time.Now()
+		conn, err := dialer.DialContext(ctx, "tcp", addr)
+		if err != nil {
+			return 0, err
+		}
+		rtt := time.Since(start)
+		return rtt, conn.Close()
+	})
+	return NewResult(TCP, addr, sent, rtts), nil
+}
@@ -0,0 +1,431 @@
+package probe
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"github.com/soheltarir/ekko/config"
+	"go.uber.org/zap"
+	"golang.org/x/net/icmp"
+	"golang.org/x/net/ipv4"
+	"math/rand"
+	"net"
+	"strings"
+	"time"
+)
+
+// Trace is the protocol name of the MTR-style path analysis prober
+const Trace = "trace"
+
+const (
+	// defaultMaxHops is the maximum TTL used when the server doesn't specify one
+	defaultMaxHops = 30
+	// traceBasePort is the first destination port used by UDP trace probes, as in traceroute
+	traceBasePort = 33434
+	// protocolICMP is the IANA protocol number of ICMP for IPv4
+	protocolICMP = 1
+	// protocolUDP is the IANA protocol number of UDP
+	protocolUDP = 17
+)
+
+func init() {
+	Register(Trace, func(history *History) Prober { return traceProber{history: history} })
+}
+
+// Hop contains the rolling statistics of a single hop on the path towards a destination,
+// accumulated over all the trace runs of the destination.
+type Hop struct {
+	// TTL is the position of the hop on the path, starting from 1
+	TTL int
+	// Addr is the address of the last router which replied for the TTL, empty if none has
+	Addr  string
+	Sent  int
+	Recv  int
+	Loss  float64
+	Last  time.Duration
+	Avg   time.Duration
+	Best  time.Duration
+	Worst time.Duration
+	// total is the sum of all the round-trip times received, used to compute Avg
+	total time.Duration
+}
+
+// Fields returns the hop statistics as logging fields
+func (h Hop) Fields() []zap.Field {
+	return []zap.Field{
+		zap.Int("hop", h.TTL),
+		zap.String("hop_addr", h.Addr),
+		zap.Int("hop_sent", h.Sent),
+		zap.Float64("hop_loss", h.Loss),
+		zap.Duration("hop_last_rtt", h.Last),
+		zap.Duration("hop_avg_rtt", h.Avg),
+		zap.Duration("hop_best_rtt", h.Best),
+		zap.Duration("hop_worst_rtt", h.Worst),
+	}
+}
+
+// record accounts a single probe sent for the hop, along with its reply if any
+func (h *Hop) record(reply *traceReply) {
+	h.Sent++
+	if reply != nil {
+		h.Recv++
+		h.Addr = reply.from.String()
+		h.Last = reply.rtt
+		h.total += reply.rtt
+		if h.Best == 0 || reply.rtt < h.Best {
+			h.Best = reply.rtt
+		}
+		if reply.rtt > h.Worst {
+			h.Worst = reply.rtt
+		}
+		h.Avg = h.total / time.Duration(h.Recv)
+	}
+	h.Loss = float64(h.Sent-h.Recv) / float64(h.Sent) * 100
+}
+
+// traceReply is a reply received for a TTL limited probe
+type traceReply struct {
+	ttl  int
+	from net.IP
+	rtt  time.Duration
+	// final is set when the reply was sent by the destination itself
+	final bool
+}
+
+// tracer sends the TTL limited probes of a trace run and matches the replies to them
+type tracer struct {
+	method string
+	dst    net.IP
+	// src is the source address the probes are sent from, any when nil
+	src     net.IP
+	maxHops int
+	id      int
+	// tos is the type of service byte of the probes, the TTL being set by the tracer itself
+	tos int
+	// conn receives the ICMP replies, and sends the probes when the method is icmp
+	conn *icmp.PacketConn
+	// udpConn sends the probes when the method is udp
+	udpConn *net.UDPConn
+}
+
+// traceProber discovers the path towards the destination by sending probes with increasing TTLs,
+// and keeps rolling loss & round-trip times of every hop like mtr, in its history
+type traceProber struct {
+	history *History
+}
+
+func (traceProber) Validate(dest config.Server) []config.Problem {
+	var problems []config.Problem
+	if method := strings.ToLower(dest.Trace.Method); method != ICMP && method != UDP {
+		problems = append(problems, config.Problem{
+			Field: "trace.method", Message: fmt.Sprintf("must be either icmp or udp, got %q", dest.Trace.Method),
+		})
+	}
+	if dest.IPFamily == config.IPv6 || dest.IPFamily == config.BothIPs {
+		problems = append(problems, config.Problem{Field: "ip_family", Message: "trace only supports IPv4"})
+	}
+	if dest.Trace.MaxHops < 1 || dest.Trace.MaxHops > 255 {
+		problems = append(problems, config.Problem{
+			Field: "trace.max_hops", Message: fmt.Sprintf("must be between 1 and 255, got %d", dest.Trace.MaxHops),
+		})
+	}
+	return problems
+}
+
+func (p traceProber) Probe(ctx context.Context, dest config.Server, log *zap.Logger) (*Result, error) {
+	method := strings.ToLower(dest.Trace.Method)
+	if method != ICMP && method != UDP {
+		return nil, fmt.Errorf("unsupported trace method %q", dest.Trace.Method)
+	}
+	ctx, cancel := context.WithTimeout(ctx, timeout(dest))
+	defer cancel()
+
+	dst, err := resolve(ctx, dest.Address, config.IPv4)
+	if err != nil {
+		return nil, err
+	}
+	m, err := newMarking(dest)
+	if err != nil {
+		return nil, err
+	}
+	t := &tracer{method: method, dst: dst, maxHops: dest.Trace.MaxHops, id: rand.Intn(1 << 16), tos: m.tos}
+	if dest.Source != "" {
+		if t.src, err = sourceAddress(dest.Source, config.IPv4); err != nil {
+			return nil, err
+		}
+	}
+	if t.maxHops <= 0 {
+		t.maxHops = defaultMaxHops
+	}
+	if err := t.open(); err != nil {
+		return nil, err
+	}
+	defer t.close()
+
+	// Unblock any pending read as soon as the probe gets cancelled
+	go func() {
+		<-ctx.Done()
+		t.conn.SetReadDeadline(time.Now())
+	}()
+
+	rounds := packetCount(dest)
+	var rtts []time.Duration
+	sent := 0
+	for round := 0; round < rounds; round++ {
+		if round > 0 {
+			select {
+			case <-ctx.Done():
+			case <-time.After(attemptInterval):
+			}
+		}
+		if ctx.Err() != nil {
+			break
+		}
+		sent++
+		replies, err := t.round(round)
+		if err != nil {
+			log.Debug("Trace round failed", zap.Int("round", round), zap.Error(err))
+			continue
+		}
+		if final := p.history.updateHops(dest, replies, t.maxHops); final != nil {
+			rtts = append(rtts, final.rtt)
+		}
+	}
+
+	result := NewResult(Trace, dst.String(), sent, rtts)
+	p.history.lock.Lock()
+	result.Hops = append([]Hop{}, p.history.hops[dest.Name]...)
+	p.history.lock.Unlock()
+	return result, nil
+}
+
+// open creates the sockets used for sending the probes and receiving the replies
+func (t *tracer) open() error {
+	local := "0.0.0.0"
+	if t.src != nil {
+		local = t.src.String()
+	}
+	conn, err := icmp.ListenPacket("ip4:icmp", local)
+	if err != nil {
+		return fmt.Errorf("trace requires privileges to open a raw ICMP socket, %w", err)
+	}
+	t.conn = conn
+	if t.method == UDP {
+		udpConn, err := net.ListenUDP("udp4", &net.UDPAddr{IP: t.src})
+		if err != nil {
+			conn.Close()
+			return err
+		}
+		t.udpConn = udpConn
+	}
+	if t.tos != 0 {
+		if err := t.setTOS(); err != nil {
+			t.close()
+			return err
+		}
+	}
+	return nil
+}
+
+// setTOS sets the type of service byte of the socket sending the probes
+func (t *tracer) setTOS() error {
+	if t.method == UDP {
+		return ipv4.NewConn(t.udpConn).SetTOS(t.tos)
+	}
+	return t.conn.IPv4PacketConn().SetTOS(t.tos)
+}
+
+func (t *tracer) close() {
+	t.conn.Close()
+	if t.udpConn != nil {
+		t.udpConn.Close()
+	}
+}
+
+// ident returns the identifier of the probe sent with the TTL during a round, which is quoted back in the replies.
+// It is the ICMP sequence number, or the offset of the destination port from traceBasePort for UDP.
+func (t *tracer) ident(round, ttl int) int {
+	seq := round*t.maxHops + ttl - 1
+	if t.method == UDP {
+		return seq % 1000
+	}
+	return seq % (1 << 16)
+}
+
+// send sends a single probe with the TTL
+func (t *tracer) send(ident, ttl int) error {
+	if t.method == UDP {
+		if err := ipv4.NewConn(t.udpConn).SetTTL(ttl); err != nil {
+			return err
+		}
+		_, err := t.udpConn.WriteTo([]byte("ekko"), &net.UDPAddr{IP: t.dst, Port: traceBasePort + ident})
+		return err
+	}
+	msg := icmp.Message{
+		Type: ipv4.ICMPTypeEcho,
+		Body: &icmp.Echo{ID: t.id, Seq: ident, Data: []byte("ekko")},
+	}
+	packet, err := msg.Marshal(nil)
+	if err != nil {
+		return err
+	}
+	if err := t.conn.IPv4PacketConn().SetTTL(ttl); err != nil {
+		return err
+	}
+	_, err = t.conn.WriteTo(packet, &net.IPAddr{IP: t.dst})
+	return err
+}
+
+// round sends a probe for every TTL up to maxHops, and collects the replies until attemptTimeout.
+// The replies are keyed by their TTL.
+func (t *tracer) round(round int) (map[int]*traceReply, error) {
+	type sentProbe struct {
+		ttl int
+		at  time.Time
+	}
+	probes := make(map[int]sentProbe, t.maxHops)
+	for ttl := 1; ttl <= t.maxHops; ttl++ {
+		ident := t.ident(round, ttl)
+		probes[ident] = sentProbe{ttl: ttl, at: time.Now()}
+		if err := t.send(ident, ttl); err != nil {
+			return nil, err
+		}
+	}
+
+	replies := make(map[int]*traceReply)
+	if err := t.conn.SetReadDeadline(time.Now().Add(attemptTimeout)); err != nil {
+		return nil, err
+	}
+	buf := make([]byte, maxDatagramSize)
+	for !t.complete(replies) {
+		n, peer, err := t.conn.ReadFrom(buf)
+		if err != nil {
+			var netErr net.Error
+			if errors.As(err, &netErr) && netErr.Timeout() {
+				break
+			}
+			return nil, err
+		}
+		received := time.Now()
+		ident, final, ok := t.match(buf[:n])
+		if !ok {
+			continue
+		}
+		probe, ok := probes[ident]
+		if !ok {
+			// A late reply to a probe of an earlier round
+			continue
+		}
+		from := peer.(*net.IPAddr).IP
+		if _, ok := replies[probe.ttl]; !ok {
+			// Routers might reply with errors too, the path only ends once the destination itself replies
+			replies[probe.ttl] = &traceReply{
+				ttl: probe.ttl, from: from, rtt: received.Sub(probe.at), final: final && from.Equal(t.dst),
+			}
+		}
+	}
+	return replies, nil
+}
+
+// complete checks whether every TTL up to the destination has been replied to
+func (t *tracer) complete(replies map[int]*traceReply) bool {
+	for ttl := 1; ttl <= t.maxHops; ttl++ {
+		reply, ok := replies[ttl]
+		if !ok {
+			return false
+		}
+		if reply.final {
+			return true
+		}
+	}
+	return true
+}
+
+// match parses an ICMP packet, and returns the identifier of the probe it replies to,
+// whether it was sent by the destination, and whether it is a reply to one of the probes at all.
+func (t *tracer) match(packet []byte) (int, bool, bool) {
+	msg, err := icmp.ParseMessage(protocolICMP, packet)
+	if err != nil {
+		return 0, false, false
+	}
+	switch body := msg.Body.(type) {
+	case *icmp.Echo:
+		if msg.Type != ipv4.ICMPTypeEchoReply || t.method != ICMP || body.ID != t.id {
+			return 0, false, false
+		}
+		return body.Seq, true, true
+	case *icmp.TimeExceeded:
+		seq, ok := t.matchQuoted(body.Data)
+		return seq, false, ok
+	case *icmp.DstUnreach:
+		// The destination replies to the UDP probes with a port unreachable error
+		seq, ok := t.matchQuoted(body.Data)
+		return seq, true, ok
+	}
+	return 0, false, false
+}
+
+// matchQuoted matches the original datagram quoted in an ICMP error to one of the probes
+func (t *tracer) matchQuoted(data []byte) (int, bool) {
+	if len(data) < 20 {
+		return 0, false
+	}
+	headerLen := int(data[0]&0x0f) * 4
+	if len(data) < headerLen+8 || !net.IP(data[16:20]).Equal(t.dst) {
+		return 0, false
+	}
+	quoted := data[headerLen:]
+	switch data[9] {
+	case protocolICMP:
+		if t.method != ICMP || int(binary.BigEndian.Uint16(quoted[4:6])) != t.id {
+			return 0, false
+		}
+		return int(binary.BigEndian.Uint16(quoted[6:8])), true
+	case protocolUDP:
+		if t.method != UDP || int(binary.BigEndian.Uint16(quoted[0:2])) != t.udpConn.LocalAddr().(*net.UDPAddr).Port {
+			return 0, false
+		}
+		return int(binary.BigEndian.Uint16(quoted[2:4])) - traceBasePort, true
+	}
+	return 0, false
+}
+
+// updateHops accounts the replies of a round in the rolling statistics of the destination's hops,
+// and returns the reply of the destination if it was reached.
+func (h *History) updateHops(dest config.Server, replies map[int]*traceReply, maxHops int) *traceReply {
+	var final *traceReply
+	last := 0
+	for ttl := 1; ttl <= maxHops; ttl++ {
+		reply, ok := replies[ttl]
+		if !ok {
+			continue
+		}
+		last = ttl
+		if reply.final {
+			final = reply
+			break
+		}
+	}
+	// When the destination isn't reached, keep a hop past the last replying one to show where the loss starts
+	if final == nil && last < maxHops {
+		last++
+	}
+
+	h.lock.Lock()
+	defer h.lock.Unlock()
+	h.track(dest)
+	hops := h.hops[dest.Name]
+	if len(hops) > last && final != nil {
+		// The path got shorter, discard the hops which are past the destination now
+		hops = hops[:last]
+	}
+	for ttl := 1; ttl <= last; ttl++ {
+		if len(hops) < ttl {
+			hops = append(hops, Hop{TTL: ttl})
+		}
+		hops[ttl-1].record(replies[ttl])
+	}
+	h.hops[dest.Name] = hops
+	return final
+}
@@ -0,0 +1,200 @@
+package probe
+
+import (
+	"bytes"
+	"context"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"github.com/soheltarir/ekko/config"
+	"go.uber.org/zap"
+	"net"
+	"strconv"
+	"strings"
+	"syscall"
+	"text/template"
+	"time"
+)
+
+// UDP is the protocol name of the UDP request-response prober
+const UDP = "udp"
+
+const (
+	// PayloadText denotes a payload template which is sent as is
+	PayloadText = "text"
+	// PayloadHex denotes a payload template which renders to a hex encoded string
+	PayloadHex = "hex"
+)
+
+const (
+	// maxDatagramSize is the size of the buffer used to read replies
+	maxDatagramSize = 65535
+	// drainTimeout is the time the replies left over by the previous attempts are read for, before an attempt
+	drainTimeout = time.Millisecond
+)
+
+// errPayloadFormat is the error of the payload formats which are neither text nor hex
+var errPayloadFormat = errors.New("unsupported payload format")
+
+func init() {
+	Register(UDP, func(*History) Prober { return udpProber{} })
+}
+
+// payloadData is the data available to the payload templates
+type payloadData struct {
+	// Seq is the sequence number of the attempt, starting from 0
+	Seq int
+	// Timestamp is the time of the attempt, in nanoseconds since epoch
+	Timestamp int64
+}
+
+// payloadTemplate renders the bytes to be sent on each attempt of a probe run
+type payloadTemplate struct {
+	tmpl   *template.Template
+	format string
+}
+
+func newPayloadTemplate(payload, format string) (*payloadTemplate, error) {
+	format = strings.ToLower(format)
+	if format == "" {
+		format = PayloadText
+	}
+	if format != PayloadText && format != PayloadHex {
+		return nil, fmt.Errorf("%w %q", errPayloadFormat, format)
+	}
+	tmpl, err := template.New("payload").Parse(payload)
+	if err != nil {
+		return nil, fmt.Errorf("invalid payload template, %w", err)
+	}
+	return &payloadTemplate{tmpl: tmpl, format: format}, nil
+}
+
+// render returns the payload for the attempt with the given sequence number
+func (p *payloadTemplate) render(seq int) ([]byte, error) {
+	var buf bytes.Buffer
+	if err := p.tmpl.Execute(&buf, payloadData{Seq: seq, Timestamp: time.Now().UnixNano()}); err != nil {
+		return nil, err
+	}
+	if p.format == PayloadHex {
+		return hex.DecodeString(strings.Join(strings.Fields(buf.String()), ""))
+	}
+	return buf.Bytes(), nil
+}
+
+// udpProber sends a datagram to the destination and waits for any reply to it. The replies are taken as is,
+// as the payload is the one of the protocol of the server, hence the late replies of the previous attempts
+// are discarded before every attempt.
+type udpProber struct{}
+
+// pad appends zeros to the payload up to size, the payloads larger than size are left as is
+func pad(payload []byte, size int) []byte {
+	if len(payload) >= size {
+		return payload
+	}
+	return append(payload, make([]byte, size-len(payload))...)
+}
+
+func (udpProber) Validate(dest config.Server) []config.Problem {
+	var problems []config.Problem
+	if dest.Port == 0 && !dest.DiscoversPort() {
+		problems = append(problems, config.Problem{Field: "port", Message: "is required by the udp protocol"})
+	}
+	payload, err := newPayloadTemplate(dest.UDP.Payload, dest.UDP.PayloadFormat)
+	if err == nil {
+		// Render a payload, as a hex payload can't be decoded until it is rendered
+		_, err = payload.render(0)
+	}
+	if errors.Is(err, errPayloadFormat) {
+		problems = append(problems, config.Problem{Field: "udp.payload_format", Message: err.Error()})
+	} else if err != nil {
+		problems = append(problems, config.Problem{Field: "udp.payload", Message: err.Error()})
+	}
+	return problems
+}
+
+func (udpProber) Probe(ctx context.Context, dest config.Server, log *zap.Logger) (*Result, error) {
+	if dest.Port == 0 {
+		return nil, errors.New("udp probe requires a port")
+	}
+	payload, err := newPayloadTemplate(dest.UDP.Payload, dest.UDP.PayloadFormat)
+	if err != nil {
+		return nil, err
+	}
+	ctx, cancel := context.WithTimeout(ctx, timeout(dest))
+	defer cancel()
+
+	m, err := newMarking(dest)
+	if err != nil {
+		return nil, err
+	}
+	ip, src, err := endpoints(ctx, dest)
+	if err != nil {
+		return nil, err
+	}
+	addr := net.JoinHostPort(ip.String(), strconv.Itoa(dest.Port))
+
+	dialer := m.dialer("udp", src)
+	conn, err := dialer.DialContext(ctx, "udp", addr)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+
+	buf := make([]byte, maxDatagramSize)
+	sent, rtts := runAttempts(ctx, packetCount(dest), log, func(ctx context.Context, seq int) (time.Duration, error) {
+		data, err := payload.render(seq)
+		if err != nil {
+			return 0, err
+		}
+		if err := drain(conn, buf); err != nil {
+			return 0, err
+		}
+		start := time.Now()
+		deadline := start.Add(attemptTimeout)
+		if d, ok := ctx.Deadline(); ok && d.Before(deadline) {
+			deadline = d
+		}
+		if err := conn.SetReadDeadline(deadline); err != nil {
+			return 0, err
+		}
+		// Unblock the pending read as soon as the probe gets cancelled, until the attempt is over
+		done := make(chan struct{})
+		defer close(done)
+		go func() {
+			select {
+			case <-ctx.Done():
+				conn.SetReadDeadline(time.Now())
+			case <-done:
+			}
+		}()
+
+		if _, err := conn.Write(pad(data, dest.PacketSize)); err != nil {
+			return 0, err
+		}
+		if _, err := conn.Read(buf); err != nil {
+			return 0, err
+		}
+		return time.Since(start), nil
+	})
+	return NewResult(UDP, addr, sent, rtts), nil
+}
+
+// drain discards the replies received after their attempt timed out, so that they aren't taken for the
+// reply of the next attempt
+func drain(conn net.Conn, buf []byte) error {
+	if err := conn.SetReadDeadline(time.Now().Add(drainTimeout)); err != nil {
+		return err
+	}
+	for {
+		_, err := conn.Read(buf)
+		if err == nil || errors.Is(err, syscall.ECONNREFUSED) {
+			// The port unreachable errors of the previous attempts are discarded too
+			continue
+		}
+		var netErr net.Error
+		if errors.As(err, &netErr) && netErr.Timeout() {
+			return nil
+		}
+		return err
+	}
+}
@@ -0,0 +1,150 @@
+package probe
+
+import (
+	"context"
+	"github.com/soheltarir/ekko/config"
+	"go.uber.org/zap"
+	"net"
+	"testing"
+	"time"
+)
+
+// udpServer listens on a local UDP port, echoing the datagrams received when echo is set, and sends their
+// payloads to the returned channel
+func udpServer(t *testing.T, echo bool) (int, <-chan []byte) {
+	t.Helper()
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("failed to listen, %v", err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	received := make(chan []byte, 16)
+	go func() {
+		buf := make([]byte, maxDatagramSize)
+		for {
+			n, addr, err := conn.ReadFrom(buf)
+			if err != nil {
+				return
+			}
+			received <- append([]byte{}, buf[:n]...)
+			if echo {
+				conn.WriteTo(buf[:n], addr)
+			}
+		}
+	}()
+	return conn.LocalAddr().(*net.UDPAddr).Port, received
+}
+
+// udpServerConfig returns a server probed over UDP with count datagrams on the port
+func udpServerConfig(port, count int, payload, format string) config.Server {
+	return config.Server{
+		Name: "udp", Address: "127.0.0.1", Protocol: UDP, Port: port,
+		MinPacketNum: count, MaxPacketNum: count, PingTimeout: 10,
+		UDP: config.UDPOptions{Payload: payload, PayloadFormat: format},
+	}
+}
+
+func TestUDPProbe(t *testing.T) {
+	tests := []struct {
+		name     string
+		echo     bool
+		payload  string
+		format   string
+		count    int
+		recv     int
+		loss     float64
+		payloads []string
+	}{
+		{"text payload", true, "ekko {{.Seq}}", PayloadText, 3, 3, 0, []string{"ekko 0", "ekko 1", "ekko 2"}},
+		{"hex payload", true, `FFFF {{printf "%02x" .Seq}}`, PayloadHex, 2, 2, 0, []string{"\xff\xff\x00", "\xff\xff\x01"}},
+		{"no reply", false, "ekko {{.Seq}}", PayloadText, 2, 0, 100, []string{"ekko 0", "ekko 1"}},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			port, received := udpServer(t, tt.echo)
+			result, err := udpProber{}.Probe(context.Background(), udpServerConfig(port, tt.count, tt.payload, tt.format), zap.NewNop())
+			if err != nil {
+				t.Fatalf("Probe() failed, %v", err)
+			}
+			if result.PacketsSent != tt.count || result.PacketsRecv != tt.recv || result.PacketLoss != tt.loss {
+				t.Errorf("sent %d, received %d, loss %v, want %d, %d, %v",
+					result.PacketsSent, result.PacketsRecv, result.PacketLoss, tt.count, tt.recv, tt.loss)
+			}
+			for _, want := range tt.payloads {
+				if got := string(<-received); got != want {
+					t.Errorf("payload %q, want %q", got, want)
+				}
+			}
+		})
+	}
+}
+
+func TestUDPProbePadding(t *testing.T) {
+	port, received := udpServer(t, true)
+	dest := udpServerConfig(port, 1, "ekko", PayloadText)
+	dest.PacketSize = 64
+	if _, err := (udpProber{}).Probe(context.Background(), dest, zap.NewNop()); err != nil {
+		t.Fatalf("Probe() failed, %v", err)
+	}
+	if got := <-received; len(got) != 64 || string(got[:4]) != "ekko" {
+		t.Errorf("payload %q, want ekko padded to 64 bytes", got)
+	}
+}
+
+func TestUDPProbeLateReply(t *testing.T) {
+	t.Parallel()
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("failed to listen, %v", err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	// Only the first datagram is replied to, once its attempt timed out
+	go func() {
+		buf := make([]byte, maxDatagramSize)
+		n, addr, err := conn.ReadFrom(buf)
+		if err != nil {
+			return
+		}
+		time.Sleep(attemptTimeout + attemptInterval/2)
+		conn.WriteTo(buf[:n], addr)
+	}()
+
+	dest := udpServerConfig(conn.LocalAddr().(*net.UDPAddr).Port, 2, "ekko {{.Seq}}", PayloadText)
+	result, err := udpProber{}.Probe(context.Background(), dest, zap.NewNop())
+	if err != nil {
+		t.Fatalf("Probe() failed, %v", err)
+	}
+	if result.PacketsSent != 2 || result.PacketsRecv != 0 {
+		t.Errorf("sent %d, received %d, want 2, 0 as the late reply isn't taken for the second one",
+			result.PacketsSent, result.PacketsRecv)
+	}
+}
+
+func TestUDPValidate(t *testing.T) {
+	tests := []struct {
+		name    string
+		dest    config.Server
+		invalid []string
+	}{
+		{"valid", udpServerConfig(9, 1, "ekko {{.Seq}}", ""), nil},
+		{"missing port", udpServerConfig(0, 1, "ekko", ""), []string{"port"}},
+		{"invalid template", udpServerConfig(9, 1, "ekko {{.Seq", ""), []string{"udp.payload"}},
+		{"invalid hex", udpServerConfig(9, 1, "zz", PayloadHex), []string{"udp.payload"}},
+		{"unknown format", udpServerConfig(9, 1, "ekko", "base64"), []string{"udp.payload_format"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			problems := udpProber{}.Validate(tt.dest)
+			if len(problems) != len(tt.invalid) {
+				t.Fatalf("Validate() = %v, want problems with %v", problems, tt.invalid)
+			}
+			for i, problem := range problems {
+				if problem.Field != tt.invalid[i] {
+					t.Errorf("problem with %s, want %s", problem.Field, tt.invalid[i])
+				}
+			}
+		})
+	}
+}
@@ -6,31 +6,26 @@ import (
 	"github.com/soheltarir/ekko/consumer"
 	"github.com/soheltarir/ekko/logger"
 	"go.uber.org/zap"
-	"time"
 )
 
 // Producer invokes the consumer callback function and sends a destination as an event.
-// the producer repeats sending of events after sleeping for Config.PingInterval seconds,
-// i.e., the destinations are pinged every 30 Config.PingInterval seconds.
+// The servers are sent as they are due by the scheduler, or all at once with Round.
 type Producer struct {
-	callbackFunc func(event consumer.Event)
+	callbackFunc func(ctx context.Context, event consumer.Event) error
 }
 
-// Start runs the producer to trigger events indefinitely
-func (p Producer) Start(ctx context.Context) {
-	for {
-		select {
-		case <-ctx.Done():
-			logger.Log.Debug("Producer received cancellation signal, exiting...")
+// Round sends every server as an event once, until ctx is done
+func (p Producer) Round(ctx context.Context) {
+	for _, server := range config.Current().Servers {
+		if err := p.send(ctx, server); err != nil {
 			return
-		default:
-			for _, server := range config.Config.Servers {
-				pingEvent := consumer.NewEvent(server)
-				logger.Log.Debug("Sending event", zap.Any("event", pingEvent))
-				p.callbackFunc(pingEvent)
-			}
-			logger.Log.Debug("Producer sleeping", zap.Int64("sleep_duration", config.Config.PingInterval))
-			time.Sleep(time.Duration(config.Config.PingInterval) * time.Second)
 		}
 	}
 }
+
+// send sends server as an event to the consumer, unless ctx is done first
+func (p Producer) send(ctx context.Context, server config.Server) error {
+	pingEvent := consumer.NewEvent(server)
+	logger.Log.Debug("Sending event", zap.Any("event", pingEvent))
+	return p.callbackFunc(ctx, pingEvent)
+}
@@ -0,0 +1,146 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"github.com/pterm/pterm"
+	"github.com/soheltarir/ekko/logger"
+	"github.com/spf13/cobra"
+	"os"
+	"sort"
+	"strconv"
+	"time"
+)
+
+// logTimeLayout is the layout of the timestamps written by zapcore.ISO8601TimeEncoder
+const logTimeLayout = "2006-01-02T15:04:05.000Z0700"
+
+// resultRecord holds the fields of a results log record used by the report
+type resultRecord struct {
+	Timestamp  string  `json:"timestamp"`
+	Message    string  `json:"message"`
+	ServerName string  `json:"server_name"`
+	ServerIP   string  `json:"server_ip"`
+	PacketLoss float64 `json:"packet_loss"`
+	AvgRtt     float64 `json:"avg_rtt"` // in milliseconds
+	MaxRtt     float64 `json:"max_rtt"` // in milliseconds
+}
+
+// serverReport aggregates the results logged for a server
+type serverReport struct {
+	name     string
+	address  string
+	runs     int
+	failures int
+	// lossSum & rttSum are summed over the successful runs, to be averaged
+	lossSum  float64
+	rttSum   float64
+	maxRtt   float64
+	recorded time.Time
+}
+
+func (s *serverReport) add(record resultRecord, recorded time.Time) {
+	s.address = record.ServerIP
+	s.recorded = recorded
+	switch record.Message {
+	case "Ping complete":
+		s.runs++
+		s.lossSum += record.PacketLoss
+		s.rttSum += record.AvgRtt
+		if record.MaxRtt > s.maxRtt {
+			s.maxRtt = record.MaxRtt
+		}
+	case "Failed to run ping", "Failed to initialise ping":
+		s.failures++
+	}
+}
+
+func (s *serverReport) row() []string {
+	avgLoss, avgRtt := "--", "--"
+	if s.runs > 0 {
+		avgLoss = fmt.Sprintf("%.2f%%", s.lossSum/float64(s.runs))
+		avgRtt = fmt.Sprintf("%.2fms", s.rttSum/float64(s.runs))
+	}
+	return []string{
+		s.name,
+		s.address,
+		strconv.Itoa(s.runs),
+		strconv.Itoa(s.failures),
+		avgLoss,
+		avgRtt,
+		fmt.Sprintf("%.2fms", s.maxRtt),
+		s.recorded.Format(time.RFC1123),
+	}
+}
+
+// newReportCommand returns the command summarising the results logged to the results file
+func newReportCommand() *cobra.Command {
+	var since time.Duration
+	cmd := &cobra.Command{
+		Use:   "report",
+		Short: "Summarise the results logged by the previous runs, per server",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if err := loadConfig(nil); err != nil {
+				return err
+			}
+			return report(logger.ResultsFile(), since)
+		},
+	}
+	cmd.Flags().DurationVar(&since, "since", 0, "only summarise the results of this last duration, e.g. 24h")
+	return cmd
+}
+
+// report prints the summary of every server found in the results file at path
+func report(path string, since time.Duration) error {
+	fp, err := os.Open(path)
+	if err != nil {
+		return fmt.Errorf("failed to open the results file, enable logging.file_enabled to record them: %w", err)
+	}
+	defer fp.Close()
+
+	var from time.Time
+	if since > 0 {
+		from = time.Now().Add(-since)
+	}
+	servers := make(map[string]*serverReport)
+	scanner := bufio.NewScanner(fp)
+	for scanner.Scan() {
+		var record resultRecord
+		if err := json.Unmarshal(scanner.Bytes(), &record); err != nil || record.ServerName == "" {
+			continue
+		}
+		recorded, err := time.Parse(logTimeLayout, record.Timestamp)
+		if err != nil || recorded.Before(from) {
+			continue
+		}
+		server, ok := servers[record.ServerName]
+		if !ok {
+			server = &serverReport{name: record.ServerName}
+			servers[record.ServerName] = server
+		}
+		server.add(record, recorded)
+	}
+	if err := scanner.Err(); err != nil {
+		return err
+	}
+	if len(servers) == 0 {
+		fmt.Printf("No results found in %s\n", path)
+		return nil
+	}
+
+	names := make([]string, 0, len(servers))
+	for name := range servers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	rows := [][]string{{
+		"Destination Name", "Address", "Runs", "Failed Runs", "Avg. Packet Loss", "Avg. Response", "Max Response",
+		"Last Recorded",
+	}}
+	for _, name := range names {
+		rows = append(rows, servers[name].row())
+	}
+	return pterm.DefaultTable.WithHasHeader().WithData(rows).Render()
+}
@@ -0,0 +1,198 @@
+package scheduler
+
+import (
+	"fmt"
+	"github.com/robfig/cron/v3"
+	"github.com/soheltarir/ekko/config"
+	"strings"
+	"time"
+)
+
+// maxCronIterations bounds the search of a cron time within the windows of a schedule
+const maxCronIterations = 10000
+
+// weekdays maps the day names accepted by the time windows
+var weekdays = map[string]time.Weekday{
+	"sun": time.Sunday,
+	"mon": time.Monday,
+	"tue": time.Tuesday,
+	"wed": time.Wednesday,
+	"thu": time.Thursday,
+	"fri": time.Friday,
+	"sat": time.Saturday,
+}
+
+func init() {
+	config.RegisterServerValidator(validate)
+}
+
+// validate checks that the schedule of the server can be parsed
+func validate(server config.Server) []config.Problem {
+	_, problems := parseSchedule(server.Schedule)
+	return problems
+}
+
+// window is a parsed config.TimeWindow
+type window struct {
+	// days the window starts on, every day when nil
+	days map[time.Weekday]bool
+	// from & to are the offsets since midnight
+	from time.Duration
+	to   time.Duration
+}
+
+// startsOn reports whether the window starts on the day
+func (w window) startsOn(day time.Weekday) bool {
+	return w.days == nil || w.days[day]
+}
+
+// contains reports whether t, with offset since the midnight of its day, is within the window
+func (w window) contains(t time.Time, offset time.Duration) bool {
+	if w.from < w.to {
+		return w.startsOn(t.Weekday()) && offset >= w.from && offset < w.to
+	}
+	// The window spans over midnight, t is either in the evening of its start, or in the morning after it
+	return (w.startsOn(t.Weekday()) && offset >= w.from) || (w.startsOn(t.AddDate(0, 0, -1).Weekday()) && offset < w.to)
+}
+
+// schedule is a parsed config.ScheduleOptions
+type schedule struct {
+	// cron is nil when the server runs on its interval
+	cron     cron.Schedule
+	location *time.Location
+	windows  []window
+}
+
+// parseSchedule parses the schedule options, returning the problems found with their field paths
+func parseSchedule(opts config.ScheduleOptions) (*schedule, []config.Problem) {
+	var problems []config.Problem
+	s := &schedule{location: time.Local}
+	if opts.Timezone != "" {
+		location, err := time.LoadLocation(opts.Timezone)
+		if err != nil {
+			problems = append(problems, config.Problem{Field: "schedule.timezone", Message: err.Error()})
+		} else {
+			s.location = location
+		}
+	}
+	if opts.Cron != "" {
+		parsed, err := cron.ParseStandard(opts.Cron)
+		if err != nil {
+			problems = append(problems, config.Problem{Field: "schedule.cron", Message: err.Error()})
+		} else {
+			if spec, ok := parsed.(*cron.SpecSchedule); ok {
+				spec.Location = s.location
+			}
+			s.cron = parsed
+		}
+	}
+	for i, tw := range opts.Windows {
+		path := fmt.Sprintf("schedule.windows[%d]", i)
+		var w window
+		var err error
+		if w.from, err = parseTimeOfDay(tw.From); err != nil {
+			problems = append(problems, config.Problem{Field: path + ".from", Message: err.Error()})
+		}
+		if w.to, err = parseTimeOfDay(tw.To); err != nil {
+			problems = append(problems, config.Problem{Field: path + ".to", Message: err.Error()})
+		} else if w.to == w.from {
+			problems = append(problems, config.Problem{Field: path + ".to", Message: "must differ from from"})
+		}
+		for j, day := range tw.Days {
+			weekday, ok := weekdays[strings.ToLower(day)]
+			if !ok {
+				problems = append(problems, config.Problem{
+					Field: fmt.Sprintf("%s.days[%d]", path, j), Message: fmt.Sprintf("unknown day %q, expected e.g. mon", day),
+				})
+				continue
+			}
+			if w.days == nil {
+				w.days = make(map[time.Weekday]bool)
+			}
+			w.days[weekday] = true
+		}
+		s.windows = append(s.windows, w)
+	}
+	return s, problems
+}
+
+// parseTimeOfDay parses a time formatted as 15:04, into its offset since midnight
+func parseTimeOfDay(value string) (time.Duration, error) {
+	t, err := time.Parse("15:04", value)
+	if err != nil {
+		return 0, fmt.Errorf("invalid time of day %q, expected e.g. 09:30", value)
+	}
+	return time.Duration(t.Hour())*time.Hour + time.Duration(t.Minute())*time.Minute, nil
+}
+
+// midnight returns the start of the day of t, in the location of the schedule
+func (s *schedule) midnight(t time.Time) time.Time {
+	t = t.In(s.location)
+	return time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, s.location)
+}
+
+// allows reports whether t is within any of the windows, any time is allowed without windows
+func (s *schedule) allows(t time.Time) bool {
+	if len(s.windows) == 0 {
+		return true
+	}
+	t = t.In(s.location)
+	offset := t.Sub(s.midnight(t))
+	for _, w := range s.windows {
+		if w.contains(t, offset) {
+			return true
+		}
+	}
+	return false
+}
+
+// within returns t if it is allowed, otherwise the start of the next window after it
+func (s *schedule) within(t time.Time) time.Time {
+	if s.allows(t) {
+		return t
+	}
+	var next time.Time
+	day := s.midnight(t)
+	for d := 0; d <= 7; d++ {
+		for _, w := range s.windows {
+			if !w.startsOn(day.Weekday()) {
+				continue
+			}
+			start := day.Add(w.from)
+			if start.After(t) && (next.IsZero() || start.Before(next)) {
+				next = start
+			}
+		}
+		if !next.IsZero() {
+			return next
+		}
+		day = day.AddDate(0, 0, 1)
+	}
+	return t
+}
+
+// next returns the time of the run following the one at last, false when the cron expression matches no time
+// within the windows, e.g. on the 30th of February, or none found in maxCronIterations
+func (s *schedule) next(last time.Time, interval time.Duration) (time.Time, bool) {
+	if s.cron == nil {
+		return s.within(last.Add(interval)), true
+	}
+	next := s.cron.Next(last)
+	for i := 0; i < maxCronIterations && !next.IsZero(); i++ {
+		if s.allows(next) {
+			return next, true
+		}
+		next = s.cron.Next(next)
+	}
+	return time.Time{}, false
+}
+
+// scheduleOf returns the parsed schedule of the server, the server runs on its interval when the schedule is
+// invalid, which the validation of the configuration prevents
+func scheduleOf(server config.Server) *schedule {
+	s, problems := parseSchedule(server.Schedule)
+	if len(problems) > 0 {
+		return &schedule{location: time.Local}
+	}
+	return s
+}
@@ -0,0 +1,268 @@
+// Package scheduler decides when each server is probed, running every server on its own interval
+// with its start time spread by a random jitter, so that the servers aren't all probed at once, or
+// on its cron expression. The runs of a server can be restricted to time windows.
+package scheduler
+
+import (
+	"context"
+	"github.com/soheltarir/ekko/config"
+	"github.com/soheltarir/ekko/logger"
+	"github.com/soheltarir/ekko/probe"
+	"go.uber.org/zap"
+	"math/rand"
+	"reflect"
+	"sync"
+	"time"
+)
+
+const (
+	// maxWait bounds the time between two checks of the due servers, so that the servers added on reload are
+	// scheduled promptly
+	maxWait = time.Second
+	// lagThreshold is the delay after which a run which was dispatched late is counted as lagged
+	lagThreshold = time.Second
+	// statsInterval is the interval at which the scheduler statistics are logged
+	statsInterval = time.Minute
+)
+
+// entry holds the schedule of a server
+type entry struct {
+	// next is the time the server is due to be probed at, zero when the server isn't scheduled
+	next time.Time
+	// inFlight is the number of probes of the server dispatched, and not complete yet
+	inFlight int
+	// interval & schedule are the settings next was computed with, to recompute it once they change
+	interval time.Duration
+	schedule config.ScheduleOptions
+	// parsed is schedule once parsed, rather than on every run
+	parsed *schedule
+}
+
+// reschedule sets the time of the next run, logging when the server isn't scheduled anymore
+func (e *entry) reschedule(server config.Server, next time.Time, ok bool) {
+	e.next = next
+	if !ok {
+		logger.Log.Warn("No run of the server matches its cron expression within its windows, it isn't scheduled",
+			zap.String("server_name", server.Name), zap.String("cron", server.Schedule.Cron))
+	}
+}
+
+// outdated reports whether the schedule settings of server changed since e was computed
+func (e *entry) outdated(server config.Server) bool {
+	return e.interval != server.Interval() || !reflect.DeepEqual(e.schedule, server.Schedule)
+}
+
+// Stats are the counters of the scheduler since it started
+type Stats struct {
+	// Runs is the number of probes dispatched
+	Runs int64
+	// Skipped is the number of runs skipped, as the previous probe of the server was still in flight
+	Skipped int64
+	// Lagged is the number of runs dispatched later than lagThreshold after their due time
+	Lagged   int64
+	TotalLag time.Duration
+	MaxLag   time.Duration
+}
+
+// Scheduler dispatches the servers of config.Current() to be probed once they are due
+type Scheduler struct {
+	dispatch func(ctx context.Context, server config.Server) error
+	lock     sync.Mutex
+	// entries are keyed by the server name
+	entries map[string]*entry
+	stats   Stats
+}
+
+// New returns a scheduler calling dispatch with every server once it is due, dispatch may block until the
+// server is picked up by a worker, in which case it must return as soon as ctx is done
+func New(dispatch func(ctx context.Context, server config.Server) error) *Scheduler {
+	return &Scheduler{dispatch: dispatch, entries: make(map[string]*entry)}
+}
+
+// Done marks the probe of the server as complete, it satisfies consumer.ResultHandler
+func (s *Scheduler) Done(server config.Server, _ *probe.Result, _ error) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	if e, ok := s.entries[server.Name]; ok && e.inFlight > 0 {
+		e.inFlight--
+	}
+}
+
+// NextRun returns the time the server is due to be probed at next, false when it isn't scheduled yet
+func (s *Scheduler) NextRun(name string) (time.Time, bool) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	e, ok := s.entries[name]
+	if !ok {
+		return time.Time{}, false
+	}
+	return e.next, !e.next.IsZero()
+}
+
+// Stats returns the counters of the scheduler
+func (s *Scheduler) Stats() Stats {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	return s.stats
+}
+
+// Run dispatches the servers as they are due, until ctx is done
+func (s *Scheduler) Run(ctx context.Context) {
+	timer := time.NewTimer(0)
+	defer timer.Stop()
+	statsTicker := time.NewTicker(statsInterval)
+	defer statsTicker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			logger.Log.Debug("Scheduler received cancellation signal, exiting...")
+			return
+		case <-statsTicker.C:
+			logger.Log.Debug("Scheduler statistics", s.Stats().fields()...)
+		case <-timer.C:
+			wait := time.Until(s.runDue(ctx))
+			if wait > maxWait {
+				wait = maxWait
+			}
+			timer.Reset(wait)
+		}
+	}
+}
+
+// runDue dispatches the servers which are due, and returns the time the next server is due at
+func (s *Scheduler) runDue(ctx context.Context) time.Time {
+	servers := config.Current().Servers
+	wakeUp := time.Now().Add(maxWait)
+	names := make(map[string]bool, len(servers))
+	for _, server := range servers {
+		if ctx.Err() != nil {
+			return wakeUp
+		}
+		names[server.Name] = true
+		if due, ok := s.dueAt(server); !ok {
+			if !due.IsZero() && due.Before(wakeUp) {
+				wakeUp = due
+			}
+			continue
+		}
+		if !s.start(server) {
+			continue
+		}
+		if err := s.dispatch(ctx, server); err != nil {
+			// The run never reached a worker, hence won't complete
+			s.Done(server, nil, err)
+			return wakeUp
+		}
+	}
+	s.forget(names)
+	return wakeUp
+}
+
+// dueAt returns the time server is due at, zero when it isn't scheduled, and whether it is due already
+func (s *Scheduler) dueAt(server config.Server) (time.Time, bool) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	e, ok := s.entries[server.Name]
+	if !ok {
+		e = &entry{}
+		s.entries[server.Name] = e
+	}
+	if !ok || e.outdated(server) {
+		e.interval, e.schedule, e.parsed = server.Interval(), server.Schedule, scheduleOf(server)
+		next, scheduled := firstRun(e.parsed, server, time.Now())
+		e.reschedule(server, next, scheduled)
+	}
+	return e.next, !e.next.IsZero() && !e.next.After(time.Now())
+}
+
+// start schedules the next run of the server, and returns whether the current one must be dispatched,
+// it is skipped when the previous probe of the server is still in flight
+func (s *Scheduler) start(server config.Server) bool {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	e := s.entries[server.Name]
+	now := time.Now()
+	lag := now.Sub(e.next)
+	next, scheduled := following(e.parsed, server, e.next, now)
+	e.reschedule(server, next, scheduled)
+
+	if e.inFlight > 0 {
+		s.stats.Skipped++
+		logger.Log.Warn("Skipping run, the previous probe of the server is still in flight",
+			append([]zap.Field{zap.String("server_name", server.Name)}, s.stats.fields()...)...)
+		return false
+	}
+	e.inFlight++
+	s.stats.Runs++
+	s.stats.TotalLag += lag
+	if lag > s.stats.MaxLag {
+		s.stats.MaxLag = lag
+	}
+	if lag > lagThreshold {
+		s.stats.Lagged++
+		logger.Log.Warn("Run dispatched late", zap.String("server_name", server.Name), zap.Duration("lag", lag),
+			zap.Int64("lagged_runs", s.stats.Lagged))
+	}
+	return true
+}
+
+// forget drops the schedule of the servers which have been removed
+func (s *Scheduler) forget(names map[string]bool) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	for name := range s.entries {
+		if !names[name] {
+			delete(s.entries, name)
+		}
+	}
+}
+
+// firstRun returns the time of the first run of server as per its parsed schedule, and whether it is scheduled.
+// The first run of a server running on its interval is spread by a random jitter, whereas a cron expression is
+// followed as is.
+func firstRun(sched *schedule, server config.Server, now time.Time) (time.Time, bool) {
+	if sched.cron != nil {
+		return sched.next(now, server.Interval())
+	}
+	return sched.within(now.Add(jitter(server))), true
+}
+
+// following returns the time of the run following the one which was due at, and started at now, and whether
+// it is scheduled
+func following(sched *schedule, server config.Server, due, now time.Time) (time.Time, bool) {
+	if sched.cron != nil {
+		return sched.next(now, server.Interval())
+	}
+	// Keep the cadence of the server, unless the runs are late by a whole interval
+	next := due.Add(server.Interval())
+	if !next.After(now) {
+		next = now.Add(server.Interval())
+	}
+	return sched.within(next), true
+}
+
+// jitter returns a random delay up to the configured jitter, bounded by the interval of the server
+func jitter(server config.Server) time.Duration {
+	max := time.Duration(config.Current().PingJitter) * time.Second
+	if interval := server.Interval(); max > interval {
+		max = interval
+	}
+	if max <= 0 {
+		return 0
+	}
+	return time.Duration(rand.Int63n(int64(max)))
+}
+
+func (st Stats) fields() []zap.Field {
+	var avgLag time.Duration
+	if st.Runs > 0 {
+		avgLag = st.TotalLag / time.Duration(st.Runs)
+	}
+	return []zap.Field{
+		zap.Int64("runs", st.Runs),
+		zap.Int64("skipped_runs", st.Skipped),
+		zap.Int64("lagged_runs", st.Lagged),
+		zap.Duration("avg_lag", avgLag),
+		zap.Duration("max_lag", st.MaxLag),
+	}
+}
@@ -0,0 +1,27 @@
+package stats
+
+import "time"
+
+// MOS estimates the call quality over a path with the given latency, jitter & packet loss (in percent),
+// using the simplified ITU-T G.107 E-model. It returns the R-factor (0 to 100) along with the
+// Mean Opinion Score derived from it (1 to 4.5).
+func MOS(latency, jitter time.Duration, loss float64) (float64, float64) {
+	// Jitter buffers add up to twice the jitter to the delay, on top of ~10ms of codec delay
+	effectiveLatency := float64(latency+2*jitter)/float64(time.Millisecond) + 10
+
+	var r float64
+	if effectiveLatency < 160 {
+		r = 93.2 - effectiveLatency/40
+	} else {
+		r = 93.2 - (effectiveLatency-120)/10
+	}
+	// Every percent of packet loss costs 2.5 R-factor points
+	r -= 2.5 * loss
+
+	if r < 0 {
+		r = 0
+	} else if r > 100 {
+		r = 100
+	}
+	return r, 1 + 0.035*r + 0.000007*r*(r-60)*(100-r)
+}
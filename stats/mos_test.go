@@ -0,0 +1,40 @@
+package stats
+
+import (
+	"math"
+	"testing"
+	"time"
+)
+
+func TestMOS(t *testing.T) {
+	tests := []struct {
+		name    string
+		latency time.Duration
+		jitter  time.Duration
+		loss    float64
+		rFactor float64
+		mos     float64
+	}{
+		// 10ms of codec delay only, R = 93.2 - 10/40
+		{"ideal", 0, 0, 0, 92.95, 1 + 0.035*92.95 + 0.000007*92.95*(92.95-60)*(100-92.95)},
+		// Above 160ms the delay costs a point every 10ms, R = 93.2 - (190-120)/10
+		{"high latency", 150 * time.Millisecond, 15 * time.Millisecond, 0, 86.2, 1 + 0.035*86.2 + 0.000007*86.2*26.2*13.8},
+		{"clamped at 0", 0, 0, 100, 0, 1},
+		{"clamped at 0 by latency", 2 * time.Second, 0, 0, 0, 1},
+		{"clamped at 100", 0, 0, -10, 100, 4.5},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r, mos := MOS(tt.latency, tt.jitter, tt.loss)
+			if math.Abs(r-tt.rFactor) > 1e-9 {
+				t.Errorf("R-factor = %v, want %v", r, tt.rFactor)
+			}
+			if math.Abs(mos-tt.mos) > 1e-9 {
+				t.Errorf("MOS = %v, want %v", mos, tt.mos)
+			}
+			if mos < 1 || mos > 4.5 {
+				t.Errorf("MOS = %v, out of the 1 to 4.5 range", mos)
+			}
+		})
+	}
+}
@@ -0,0 +1,100 @@
+// Package stats computes the statistics of the round-trip times collected during a probe run,
+// independently of the protocol used to collect them.
+package stats
+
+import (
+	"math"
+	"sort"
+	"time"
+)
+
+// Summary contains the statistics of the round-trip times of a probe run
+type Summary struct {
+	Min    time.Duration
+	Max    time.Duration
+	Avg    time.Duration
+	StdDev time.Duration
+	// Jitter is the interarrival jitter, as defined by RFC 3550
+	Jitter time.Duration
+	P50    time.Duration
+	P90    time.Duration
+	P99    time.Duration
+}
+
+// Summarise computes all the statistics of the round-trip times, which are expected in the order they were received
+func Summarise(rtts []time.Duration) Summary {
+	if len(rtts) == 0 {
+		return Summary{}
+	}
+	sorted := append([]time.Duration{}, rtts...)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i] < sorted[j] })
+	return Summary{
+		Min:    sorted[0],
+		Max:    sorted[len(sorted)-1],
+		Avg:    Mean(rtts),
+		StdDev: StdDev(rtts),
+		Jitter: Jitter(rtts),
+		P50:    percentile(sorted, 50),
+		P90:    percentile(sorted, 90),
+		P99:    percentile(sorted, 99),
+	}
+}
+
+// Mean returns the arithmetic mean of the round-trip times
+func Mean(rtts []time.Duration) time.Duration {
+	if len(rtts) == 0 {
+		return 0
+	}
+	var total time.Duration
+	for _, rtt := range rtts {
+		total += rtt
+	}
+	return total / time.Duration(len(rtts))
+}
+
+// StdDev returns the population standard deviation of the round-trip times
+func StdDev(rtts []time.Duration) time.Duration {
+	if len(rtts) == 0 {
+		return 0
+	}
+	mean := float64(Mean(rtts))
+	var sumSquares float64
+	for _, rtt := range rtts {
+		diff := float64(rtt) - mean
+		sumSquares += diff * diff
+	}
+	return time.Duration(math.Sqrt(sumSquares / float64(len(rtts))))
+}
+
+// Jitter returns the interarrival jitter of the round-trip times as per RFC 3550 section 6.4.1,
+// i.e., the running average of the difference between consecutive round-trip times, smoothed by a factor of 1/16.
+func Jitter(rtts []time.Duration) time.Duration {
+	var jitter float64
+	for i := 1; i < len(rtts); i++ {
+		diff := math.Abs(float64(rtts[i] - rtts[i-1]))
+		jitter += (diff - jitter) / 16
+	}
+	return time.Duration(jitter)
+}
+
+// Percentile returns the p-th percentile (0 < p <= 100) of the round-trip times, using the nearest-rank method
+func Percentile(rtts []time.Duration, p float64) time.Duration {
+	if len(rtts) == 0 {
+		return 0
+	}
+	sorted := append([]time.Duration{}, rtts...)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i] < sorted[j] })
+	return percentile(sorted, p)
+}
+
+// percentile is Percentile for round-trip times which are already sorted
+func percentile(sorted []time.Duration, p float64) time.Duration {
+	rank := int(math.Ceil(p / 100 * float64(len(sorted))))
+	if rank < 1 {
+		rank = 1
+	}
+	if rank > len(sorted) {
+		rank = len(sorted)
+	}
+	return sorted[rank-1]
+}
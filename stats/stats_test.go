@@ -0,0 +1,126 @@
+package stats
+
+import (
+	"testing"
+	"time"
+)
+
+// ms builds round-trip times out of milliseconds
+func ms(values ...float64) []time.Duration {
+	rtts := make([]time.Duration, len(values))
+	for i, v := range values {
+		rtts[i] = time.Duration(v * float64(time.Millisecond))
+	}
+	return rtts
+}
+
+// hundred returns the round-trip times 1ms up to 100ms, shuffled so that sorting is required
+func hundred() []time.Duration {
+	rtts := make([]time.Duration, 100)
+	for i := range rtts {
+		rtts[i] = time.Duration((i*37)%100+1) * time.Millisecond
+	}
+	return rtts
+}
+
+func TestPercentile(t *testing.T) {
+	tests := []struct {
+		name string
+		rtts []time.Duration
+		p    float64
+		want time.Duration
+	}{
+		{"empty", nil, 50, 0},
+		{"single p50", ms(7), 50, 7 * time.Millisecond},
+		{"single p95", ms(7), 95, 7 * time.Millisecond},
+		{"single p99", ms(7), 99, 7 * time.Millisecond},
+		{"pair p50", ms(20, 10), 50, 10 * time.Millisecond},
+		{"pair p95", ms(20, 10), 95, 20 * time.Millisecond},
+		{"pair p99", ms(20, 10), 99, 20 * time.Millisecond},
+		{"hundred p50", hundred(), 50, 50 * time.Millisecond},
+		{"hundred p95", hundred(), 95, 95 * time.Millisecond},
+		{"hundred p99", hundred(), 99, 99 * time.Millisecond},
+		{"hundred p100", hundred(), 100, 100 * time.Millisecond},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := Percentile(tt.rtts, tt.p); got != tt.want {
+				t.Errorf("Percentile(%v) = %v, want %v", tt.p, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestJitter(t *testing.T) {
+	tests := []struct {
+		name string
+		rtts []time.Duration
+		want time.Duration
+	}{
+		{"empty", nil, 0},
+		{"single", ms(10), 0},
+		{"constant", ms(10, 10, 10), 0},
+		// J1 = 10/16 = 0.625ms, J2 = J1 + (10 - J1)/16 = 1.2109375ms
+		{"alternating", ms(10, 20, 10), 1210937 * time.Nanosecond},
+		// The difference is absolute, hence a decrease counts as much as an increase
+		{"decreasing", ms(26, 10), time.Millisecond},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := Jitter(tt.rtts); got != tt.want {
+				t.Errorf("Jitter() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSummarise(t *testing.T) {
+	tests := []struct {
+		name string
+		rtts []time.Duration
+		want Summary
+	}{
+		{"empty", nil, Summary{}},
+		{"single", ms(5), Summary{
+			Min: 5 * time.Millisecond, Max: 5 * time.Millisecond, Avg: 5 * time.Millisecond,
+			P50: 5 * time.Millisecond, P90: 5 * time.Millisecond, P99: 5 * time.Millisecond,
+		}},
+		// The population standard deviation of 2, 4, 4, 4, 5, 5, 7 & 9 is 2
+		{"spread", ms(4, 2, 4, 5, 4, 9, 5, 7), Summary{
+			Min: 2 * time.Millisecond, Max: 9 * time.Millisecond, Avg: 5 * time.Millisecond, StdDev: 2 * time.Millisecond,
+			// The differences are 2, 2, 1, 1, 5, 4 & 2ms, J7 = 1906736265625/2097152ns ≈ 0.909ms
+			Jitter: 909202 * time.Nanosecond,
+			P50:    4 * time.Millisecond, P90: 9 * time.Millisecond, P99: 9 * time.Millisecond,
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := Summarise(tt.rtts); got != tt.want {
+				t.Errorf("Summarise() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestMeanAndStdDev(t *testing.T) {
+	tests := []struct {
+		name   string
+		rtts   []time.Duration
+		mean   time.Duration
+		stdDev time.Duration
+	}{
+		{"empty", nil, 0, 0},
+		{"constant", ms(3, 3, 3), 3 * time.Millisecond, 0},
+		{"pair", ms(10, 30), 20 * time.Millisecond, 10 * time.Millisecond},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := Mean(tt.rtts); got != tt.mean {
+				t.Errorf("Mean() = %v, want %v", got, tt.mean)
+			}
+			if got := StdDev(tt.rtts); got != tt.stdDev {
+				t.Errorf("StdDev() = %v, want %v", got, tt.stdDev)
+			}
+		})
+	}
+}
@@ -4,6 +4,7 @@ import (
 	"github.com/pterm/pterm"
 	"github.com/soheltarir/ekko/config"
 	"github.com/soheltarir/ekko/logger"
+	"github.com/soheltarir/ekko/probe"
 )
 
 func header() string {
@@ -19,13 +20,14 @@ func header() string {
 
 func programInfo(status config.ConsumerStatus) []interface{} {
 	var lines []interface{}
-	if config.Config.Logging.FileEnabled {
+	if config.Current().Logging.FileEnabled {
 		lines = append(lines,
 			pterm.Info.Sprintln("File logging enabled"),
 			pterm.Info.Sprintfln("Results Log path: %s", logger.LogPath.Results),
 			pterm.Info.Sprintfln("Debug Log path: %s", logger.LogPath.Debug),
 		)
 	}
+	lines = append(lines, pterm.Info.Sprintfln("ICMP mode: %s", probe.ICMPMode()))
 	lines = append(lines, pterm.Info.Sprintln(status))
 	return lines
 }
@@ -2,11 +2,11 @@ package ui
 
 import (
 	"context"
-	"github.com/go-ping/ping"
 	"github.com/google/uuid"
 	"github.com/pterm/pterm"
 	"github.com/soheltarir/ekko/config"
 	"github.com/soheltarir/ekko/logger"
+	"github.com/soheltarir/ekko/probe"
 	"go.uber.org/zap"
 )
 
@@ -15,6 +15,7 @@ type Element int
 const (
 	StatusInfo Element = iota
 	TableRow
+	Destinations
 )
 
 type Event struct {
@@ -31,10 +32,10 @@ func NewStatusEvent(status config.ConsumerStatus) Event {
 	}
 }
 
-func NewTableRowEvent(server config.Server, stats *ping.Statistics, err error) Event {
+func NewTableRowEvent(server config.Server, result *probe.Result, err error) Event {
 	data := map[string]interface{}{
 		"server": server,
-		"stats":  stats,
+		"result": result,
 	}
 	if err != nil {
 		data["error"] = err.Error()
@@ -44,8 +45,17 @@ func NewTableRowEvent(server config.Server, stats *ping.Statistics, err error) E
 	return Event{Element: TableRow, Data: data}
 }
 
-func (u EkkoUI) Listen(ctx context.Context) {
-	if !config.Config.UIEnabled {
+// NewDestinationsEvent returns an event which replaces the destinations shown in the table
+func NewDestinationsEvent(servers []config.Server) Event {
+	return Event{
+		ID:      uuid.New(),
+		Element: Destinations,
+		Data:    servers,
+	}
+}
+
+func (u *EkkoUI) Listen(ctx context.Context) {
+	if !config.Current().UIEnabled {
 		// Skip if UI is disabled
 		return
 	}
@@ -59,11 +69,12 @@ func (u EkkoUI) Listen(ctx context.Context) {
 				// Build the row for the event
 				eventData := event.Data.(map[string]interface{})
 				server := eventData["server"].(config.Server)
-				stats := eventData["stats"].(*ping.Statistics)
+				result := eventData["result"].(*probe.Result)
 				err := eventData["error"].(string)
-				row := statsRow(server, stats, err)
 				// Update the corresponding row
-				u.rows[u.addressMap[server.Address]] = row
+				u.setStats(server, result, err)
+			} else if event.Element == Destinations {
+				u.setDestinations(event.Data.([]config.Server))
 			}
 			u.render()
 		case <-ctx.Done():
@@ -73,11 +84,11 @@ func (u EkkoUI) Listen(ctx context.Context) {
 	}
 }
 
-func (u EkkoUI) clearDisplay() {
+func (u *EkkoUI) clearDisplay() {
 	print("\033[H\033[2J")
 }
 
-func (u EkkoUI) render() {
+func (u *EkkoUI) render() {
 	table, err := networkStatsTable(u.rows)
 	if err != nil {
 		// Skip render
@@ -96,6 +107,19 @@ func (u EkkoUI) render() {
 		// Network Stats table
 		{{Data: table}},
 	}
+	// Drill-down of the path towards the traced destinations
+	for _, name := range u.traced {
+		hops, ok := u.hops[name]
+		if !ok {
+			continue
+		}
+		hopsTable, err := hopsTable(name, hops)
+		if err != nil {
+			logger.Log.Warn("Failed to render hops table", zap.String("server_name", name), zap.Error(err))
+			continue
+		}
+		panels = append(panels, []pterm.Panel{{Data: pterm.Sprintln()}}, []pterm.Panel{{Data: hopsTable}})
+	}
 	u.clearDisplay()
 	if err := pterm.DefaultPanel.WithPanels(panels).Render(); err != nil {
 		logger.Log.Panic("Failed to render panels", zap.Error(err))
@@ -0,0 +1,115 @@
+package ui
+
+import (
+	"fmt"
+	"github.com/pterm/pterm"
+	"github.com/soheltarir/ekko/config"
+	"github.com/soheltarir/ekko/probe"
+	"time"
+)
+
+// ungrouped is the name of the section gathering the destinations which aren't part of any group
+const ungrouped = "Ungrouped"
+
+// section is a group of destinations shown under a header row, with the aggregate stats of the group
+type section struct {
+	group config.Group
+	rows  []StatRow
+}
+
+// sections splits the rows of the destinations by group, in the order of the configured groups.
+// The groups without any destination are left out.
+func sections(groups []config.Group, destinations []config.Server, statRows map[string]StatRow) []section {
+	members := make(map[string][]StatRow)
+	for _, dest := range destinations {
+		members[dest.Group] = append(members[dest.Group], statRows[dest.Name])
+	}
+	var found []section
+	for _, group := range groups {
+		if rows := members[group.Name]; len(rows) > 0 {
+			found = append(found, section{group: group, rows: rows})
+		}
+	}
+	if rows := members[""]; len(rows) > 0 {
+		found = append(found, section{group: config.Group{Name: ungrouped}, rows: rows})
+	}
+	return found
+}
+
+// title returns the name of the group, marked as expanded or collapsed
+func (g section) title() string {
+	marker := "▼"
+	if g.group.Collapsed {
+		marker = "▶"
+	}
+	return pterm.NewStyle(pterm.Bold, pterm.FgLightCyan).Sprintf("%s %s", marker, g.group.Name)
+}
+
+// build returns the header row of the section, aggregating the stats of the destinations of the group
+// which reported successfully: the packets sent are summed, whereas the loss, MOS & response are averaged
+func (g section) build(cols columns) []string {
+	header := tableHeader(cols)
+	row := make([]string, len(header))
+	for i := range row {
+		row[i] = "--"
+	}
+	row[0] = g.title()
+	row[1] = fmt.Sprintf("%d servers", len(g.rows))
+
+	aggregate := &probe.Result{}
+	var reporting, failing int
+	var loss, mos float64
+	var avgRtt time.Duration
+	var recorded time.Time
+	for _, member := range g.rows {
+		if member.recorded.After(recorded) {
+			recorded = member.recorded
+		}
+		if member.err != "" {
+			failing++
+			continue
+		}
+		if member.stats == nil || member.stats.PacketsSent == 0 {
+			continue
+		}
+		reporting++
+		aggregate.PacketsSent += member.stats.PacketsSent
+		loss += member.stats.PacketLoss
+		mos += member.stats.MOS
+		avgRtt += member.stats.AvgRtt
+		if aggregate.MinRtt == 0 || member.stats.MinRtt < aggregate.MinRtt {
+			aggregate.MinRtt = member.stats.MinRtt
+		}
+		if member.stats.MaxRtt > aggregate.MaxRtt {
+			aggregate.MaxRtt = member.stats.MaxRtt
+		}
+	}
+	if reporting > 0 {
+		aggregate.PacketLoss = loss / float64(reporting)
+		aggregate.MOS = mos / float64(reporting)
+		aggregate.AvgRtt = avgRtt / time.Duration(reporting)
+		stats := StatRow{stats: aggregate}
+		i := cols.leading()
+		row[i] = fmt.Sprintf("%d", aggregate.PacketsSent)
+		row[i+1] = stats.loss(aggregate.PacketLoss)
+		row[i+2] = stats.mos()
+		row[i+3] = stats.rtt(aggregate.AvgRtt)
+		row[i+4] = stats.rtt(aggregate.MinRtt)
+		row[i+5] = stats.rtt(aggregate.MaxRtt)
+	}
+
+	// The time recorded is the first of the trailing columns, which follow the optional HTTP ones
+	recordedIdx := len(StatsTableHeader) - trailingColumns - leadingColumns + cols.leading()
+	if cols.http {
+		recordedIdx += len(HTTPTableHeader)
+	}
+	if !recorded.IsZero() {
+		row[recordedIdx] = recorded.Format("2006-01-02 15:04:05")
+	}
+	details := fmt.Sprintf("%d/%d reporting", reporting, len(g.rows))
+	if failing > 0 {
+		details += pterm.NewStyle(pterm.FgRed).Sprintf(", %d failing", failing)
+	}
+	row[len(row)-1] = details
+	return row
+}
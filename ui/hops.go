@@ -0,0 +1,56 @@
+package ui
+
+import (
+	"fmt"
+	"github.com/pterm/pterm"
+	"github.com/soheltarir/ekko/probe"
+)
+
+// HopsTableHeader contains the header row for the per-hop drill-down table of a traced destination
+var HopsTableHeader = []string{
+	"Hop",
+	"Host",
+	"Loss",
+	"Sent",
+	"Last",
+	"Avg.",
+	"Best",
+	"Worst",
+}
+
+// hopRows returns the formatted rows of the drill-down table, including the header
+func hopRows(hops []probe.Hop) [][]string {
+	rows := [][]string{HopsTableHeader}
+	row := StatRow{}
+	for _, hop := range hops {
+		if hop.Recv == 0 {
+			style := pterm.NewStyle(pterm.FgRed)
+			rows = append(rows, []string{
+				fmt.Sprintf("%d", hop.TTL), style.Sprint("???"), row.loss(hop.Loss), fmt.Sprintf("%d", hop.Sent),
+				style.Sprint("--"), style.Sprint("--"), style.Sprint("--"), style.Sprint("--"),
+			})
+			continue
+		}
+		rows = append(rows, []string{
+			fmt.Sprintf("%d", hop.TTL),
+			hop.Addr,
+			row.loss(hop.Loss),
+			fmt.Sprintf("%d", hop.Sent),
+			row.rtt(hop.Last),
+			row.rtt(hop.Avg),
+			row.rtt(hop.Best),
+			row.rtt(hop.Worst),
+		})
+	}
+	return rows
+}
+
+// hopsTable renders the drill-down table of a traced destination, titled with its name
+func hopsTable(name string, hops []probe.Hop) (string, error) {
+	table, err := pterm.DefaultTable.WithHasHeader(true).WithBoxed(true).WithData(hopRows(hops)).Srender()
+	if err != nil {
+		return "", err
+	}
+	title := pterm.NewStyle(pterm.Bold).Sprintf("Path to %s", name)
+	return pterm.Sprintln(title) + table, nil
+}
@@ -2,9 +2,12 @@ package ui
 
 import (
 	"fmt"
-	"github.com/go-ping/ping"
 	"github.com/pterm/pterm"
 	"github.com/soheltarir/ekko/config"
+	"github.com/soheltarir/ekko/probe"
+	"net"
+	"strconv"
+	"strings"
 	"time"
 )
 
@@ -20,26 +23,110 @@ var StatsTableHeader = []string{
 	"Address",
 	"Packets Sent",
 	"Packet Loss",
+	"MOS",
 	"Avg. Response",
 	"Min. Response",
 	"Max. Response",
+	"Jitter",
+	"P50",
+	"P90",
+	"P99",
+	"Std. Dev.",
 	"Time Recorded",
 	"Details",
 }
 
+const (
+	// leadingColumns is the number of columns of StatsTableHeader placed before the source
+	leadingColumns = 2
+	// trailingColumns is the number of columns of StatsTableHeader placed after the optional ones
+	trailingColumns = 2
+)
+
+// HTTPTableHeader contains the phase columns added to the table when any of the destinations is probed over HTTP
+var HTTPTableHeader = []string{
+	"DNS",
+	"Connect",
+	"TLS",
+	"TTFB",
+	"Status",
+}
+
+// NextRunHeader is the column added after the time recorded, when any of the destinations runs on a schedule
+const NextRunHeader = "Next Run"
+
+// SourceHeader is the column added after the address, when any of the destinations is probed from a source
+const SourceHeader = "Source"
+
+// columns are the optional columns of the table, enabled as per the destinations shown
+type columns struct {
+	// http adds the HTTP phase timings, when any of the destinations is probed over HTTP
+	http bool
+	// nextRun adds the time of the next run, when any of the destinations runs on a schedule
+	nextRun bool
+	// source adds the source the probes are sent from, when any of the destinations is probed from a source
+	source bool
+}
+
+// leading returns the number of columns placed before the packets sent
+func (c columns) leading() int {
+	if c.source {
+		return leadingColumns + 1
+	}
+	return leadingColumns
+}
+
+// newColumns returns the optional columns required by the destinations
+func newColumns(destinations []config.Server) columns {
+	var cols columns
+	for _, dest := range destinations {
+		cols.http = cols.http || strings.EqualFold(dest.Protocol, probe.HTTP)
+		cols.nextRun = cols.nextRun || dest.Scheduled()
+		cols.source = cols.source || dest.Source != ""
+	}
+	return cols
+}
+
+// tableHeader returns the header row of the table, with the optional columns enabled.
+// The source is placed right after the address, the HTTP columns are placed between the response
+// times and the time recorded, whereas the next run is placed right after the time recorded.
+func tableHeader(cols columns) []string {
+	header := append([]string{}, StatsTableHeader[:leadingColumns]...)
+	if cols.source {
+		header = append(header, SourceHeader)
+	}
+	leading := len(StatsTableHeader) - trailingColumns
+	header = append(header, StatsTableHeader[leadingColumns:leading]...)
+	if cols.http {
+		header = append(header, HTTPTableHeader...)
+	}
+	header = append(header, StatsTableHeader[leading])
+	if cols.nextRun {
+		header = append(header, NextRunHeader)
+	}
+	return append(header, StatsTableHeader[leading+1:]...)
+}
+
 // StatRow signifies a network statistics row in the table
 type StatRow struct {
 	dest  config.Server
-	stats *ping.Statistics
+	stats *probe.Result
 	err   string
+	// columns are the optional columns of the row
+	columns columns
+	// recorded is the time the stats were received at, zero until the first result
+	recorded time.Time
+	// next is the time the destination is due at as per the scheduler, zero when unknown
+	next time.Time
 }
 
 func (s StatRow) rtt(datum time.Duration) string {
 	ms := datum.Milliseconds()
+	thresholds := config.Current().Thresholds.Rtt
 	color := DefaultGoodColor
-	if ms > 200 {
+	if ms > thresholds.Error {
 		color = DefaultErrorColor
-	} else if ms > 100 && ms < 200 {
+	} else if ms > thresholds.Warn {
 		color = DefaultWarnColor
 	}
 	style := pterm.NewStyle(color)
@@ -47,16 +134,32 @@ func (s StatRow) rtt(datum time.Duration) string {
 }
 
 func (s StatRow) loss(datum float64) string {
+	thresholds := config.Current().Thresholds.Loss
 	color := DefaultGoodColor
-	if datum > 10 {
+	if datum > thresholds.Error {
 		color = DefaultErrorColor
-	} else if datum > 5 && datum < 10 {
+	} else if datum > thresholds.Warn {
 		color = DefaultWarnColor
 	}
 	style := pterm.NewStyle(color, pterm.Italic)
 	return style.Sprintf("%0.2f%%", datum)
 }
 
+func (s StatRow) mos() string {
+	if s.stats.PacketsSent == 0 {
+		return "--"
+	}
+	thresholds := config.Current().Thresholds.MOS
+	color := DefaultGoodColor
+	if s.stats.MOS < thresholds.Error {
+		color = DefaultErrorColor
+	} else if s.stats.MOS < thresholds.Warn {
+		color = DefaultWarnColor
+	}
+	style := pterm.NewStyle(color, pterm.Bold)
+	return style.Sprintf("%0.2f", s.stats.MOS)
+}
+
 func (s StatRow) name() string {
 	var style *pterm.Style
 	if s.err != "" {
@@ -74,40 +177,157 @@ func (s StatRow) addr() string {
 	} else {
 		style = pterm.NewStyle(pterm.Underscore)
 	}
+	if s.dest.Port != 0 {
+		return style.Sprint(net.JoinHostPort(s.dest.Address, strconv.Itoa(s.dest.Port)))
+	}
 	return style.Sprint(s.dest.Address)
 }
 
+// source returns the source the destination is probed from, any when it isn't set
+func (s StatRow) source() string {
+	if s.dest.Source == "" {
+		return "--"
+	}
+	return s.dest.Source
+}
+
+// leading returns the cells identifying the destination, placed before the stats
+func (s StatRow) leading() []string {
+	cells := []string{s.name(), s.addr()}
+	if s.columns.source {
+		cells = append(cells, s.source())
+	}
+	return cells
+}
+
 func (s StatRow) error() string {
 	style := pterm.NewStyle(pterm.Italic, pterm.FgRed)
 	return style.Sprint(s.err)
 }
 
+// phases returns the HTTP phase timings cells, which are blank for the destinations not probed over HTTP
+func (s StatRow) phases() []string {
+	if s.stats == nil || s.stats.HTTP == nil {
+		return []string{"--", "--", "--", "--", "--"}
+	}
+	timing := s.stats.HTTP
+	status := "--"
+	if timing.StatusCode != 0 {
+		status = fmt.Sprintf("%d", timing.StatusCode)
+	}
+	if s.stats.PacketsRecv == 0 {
+		// None of the requests succeeded, hence there are no timings
+		return []string{"--", "--", "--", "--", status}
+	}
+	return []string{
+		s.rtt(timing.DNSLookup),
+		s.rtt(timing.TCPConnect),
+		s.rtt(timing.TLSHandshake),
+		s.rtt(timing.TTFB),
+		status,
+	}
+}
+
+// details summarises the protocol specific information of the result
+func (s StatRow) details() string {
+	if s.stats != nil && s.stats.PMTU != nil {
+		return s.pathMTU(*s.stats.PMTU)
+	}
+	if s.stats != nil && s.stats.DNS != nil {
+		return s.dnsAnswer(*s.stats.DNS)
+	}
+	if s.stats == nil || len(s.stats.Hops) == 0 {
+		return "----"
+	}
+	for _, hop := range s.stats.Hops {
+		if hop.Loss > 0 {
+			return pterm.NewStyle(pterm.FgLightYellow).Sprintf("%d hops, loss from hop %d", len(s.stats.Hops), hop.TTL)
+		}
+	}
+	return fmt.Sprintf("%d hops", len(s.stats.Hops))
+}
+
+// pathMTU summarises the outcome of the path MTU discovery, highlighting the MTU once it changed
+func (s StatRow) pathMTU(found probe.PathMTU) string {
+	if found.MTU == 0 {
+		return pterm.NewStyle(pterm.FgRed).Sprint("MTU unknown")
+	}
+	summary := fmt.Sprintf("MTU %d", found.MTU)
+	if found.FragmentationNeeded > 0 {
+		summary += fmt.Sprintf(", %d frag needed", found.FragmentationNeeded)
+	}
+	if found.Changed() {
+		return pterm.NewStyle(pterm.FgLightYellow).Sprintf("%s (was %d)", summary, found.Previous)
+	}
+	return summary
+}
+
+// dnsAnswer summarises the last response of the resolver, highlighting the ones which aren't NOERROR
+func (s StatRow) dnsAnswer(answer probe.DNSAnswer) string {
+	summary := fmt.Sprintf("%s, %d answers", answer.Rcode, answer.Answers)
+	if answer.Rcode != "NOERROR" {
+		return pterm.NewStyle(pterm.FgLightYellow).Sprint(summary)
+	}
+	return summary
+}
+
+// nextRun returns the time the destination is due at after the recorded run, for the scheduled destinations
+func (s StatRow) nextRun() string {
+	if !s.dest.Scheduled() || s.recorded.IsZero() || s.next.IsZero() {
+		return "--"
+	}
+	if y, m, d := s.next.Date(); y == s.recorded.Year() && m == s.recorded.Month() && d == s.recorded.Day() {
+		return s.next.Format("15:04:05")
+	}
+	return s.next.Format("Mon 02 Jan 15:04")
+}
+
+// timeRecorded returns the time the stats were received at, none until the first result
+func (s StatRow) timeRecorded() string {
+	if s.recorded.IsZero() {
+		return "--"
+	}
+	return s.recorded.Format("2006-01-02 15:04:05")
+}
+
+// trailing returns the cells placed after the optional HTTP columns
+func (s StatRow) trailing(details string) []string {
+	cells := []string{s.timeRecorded()}
+	if s.columns.nextRun {
+		cells = append(cells, s.nextRun())
+	}
+	return append(cells, details)
+}
+
 // build adds formatting and styles to the values in the row
 func (s StatRow) build() []string {
-	timeRecorded := time.Now().Format("2006-01-02 15:04:05")
 	if s.err != "" {
 		style := pterm.NewStyle(pterm.FgRed)
-		return []string{
-			s.name(), s.addr(),
-			style.Sprint("--"), style.Sprint("--"), style.Sprint("--"), style.Sprint("--"),
-			style.Sprint("--"), timeRecorded, s.error(),
+		row := s.leading()
+		blanks := len(StatsTableHeader) - leadingColumns - trailingColumns
+		if s.columns.http {
+			blanks += len(HTTPTableHeader)
 		}
+		for i := 0; i < blanks; i++ {
+			row = append(row, style.Sprint("--"))
+		}
+		return append(row, s.trailing(s.error())...)
 	}
-	return []string{
-		s.name(),
-		s.addr(),
+	row := append(s.leading(),
 		fmt.Sprintf("%d", s.stats.PacketsSent),
 		s.loss(s.stats.PacketLoss),
+		s.mos(),
 		s.rtt(s.stats.AvgRtt),
 		s.rtt(s.stats.MinRtt),
 		s.rtt(s.stats.MaxRtt),
-		timeRecorded,
-		"----",
+		s.rtt(s.stats.Jitter),
+		s.rtt(s.stats.P50Rtt),
+		s.rtt(s.stats.P90Rtt),
+		s.rtt(s.stats.P99Rtt),
+		s.rtt(s.stats.StdDevRtt),
+	)
+	if s.columns.http {
+		row = append(row, s.phases()...)
 	}
-}
-
-// statsRow returns formatted network stats Data as a row
-func statsRow(dest config.Server, stats *ping.Statistics, err string) []string {
-	row := StatRow{dest: dest, stats: stats, err: err}
-	return row.build()
+	return append(row, s.trailing(s.details())...)
 }
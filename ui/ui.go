@@ -1,42 +1,139 @@
 package ui
 
 import (
-	"github.com/go-ping/ping"
 	"github.com/soheltarir/ekko/config"
+	"github.com/soheltarir/ekko/probe"
+	"github.com/soheltarir/ekko/scheduler"
+	"strings"
+	"time"
 )
 
 // EkkoUI exposes all methods and objects for displaying network statistics
 type EkkoUI struct {
 	// rows is the list of destination stats (including the header)
 	rows [][]string
-	// addressMap stores the link between the destination address, and it's
-	// corresponding row index
-	addressMap map[string]int
+	// destinations are the destinations shown, and groups the sections they are shown under
+	destinations []config.Server
+	groups       []config.Group
+	// nameMap stores the link between the destination name, and it's
+	// corresponding index in destinations
+	nameMap map[string]int
+	// statRows stores the latest stats of every destination keyed by the name,
+	// so that the rows could be rebuilt when the destinations change
+	statRows map[string]StatRow
 	// eventChan is used for listening to UI change events
 	eventChan      chan Event
 	consumerStatus config.ConsumerStatus
+	// columns are the optional columns of the table
+	columns columns
+	// hops stores the path of the traced destinations, keyed by their name
+	hops map[string][]probe.Hop
+	// traced lists the names of the traced destinations, in the order of their rows
+	traced []string
+	// scheduler tells the time the destinations are due at next
+	scheduler *scheduler.Scheduler
 }
 
-func New(destinations []config.Server, uiChan chan Event) *EkkoUI {
-	if !config.Config.UIEnabled {
+func New(destinations []config.Server, uiChan chan Event, probeScheduler *scheduler.Scheduler) *EkkoUI {
+	if !config.Current().UIEnabled {
 		// Skip if UI is disabled
 		return &EkkoUI{}
 	}
 	ui := EkkoUI{
-		rows:           make([][]string, 0),
-		addressMap:     make(map[string]int),
+		statRows:       make(map[string]StatRow),
+		hops:           make(map[string][]probe.Hop),
 		eventChan:      uiChan,
 		consumerStatus: config.NotStarted,
+		scheduler:      probeScheduler,
 	}
-	// Add the header row
-	ui.rows = append(ui.rows, StatsTableHeader)
-	// Populate the ui with the destinations containing empty Data
-	for idx, dest := range destinations {
-		// Create an empty stats row for initialisation
-		stats := &ping.Statistics{Addr: dest.Address}
-		ui.rows = append(ui.rows, statsRow(dest, stats, ""))
-		ui.addressMap[dest.Address] = idx + 1
-	}
+	ui.setDestinations(destinations)
 	ui.render()
 	return &ui
 }
+
+// setDestinations rebuilds the rows of the table for the destinations, keeping the stats
+// of the ones already shown and dropping the ones which aren't part of destinations anymore
+func (u *EkkoUI) setDestinations(destinations []config.Server) {
+	u.columns = newColumns(destinations)
+	u.traced = nil
+	for _, dest := range destinations {
+		if strings.EqualFold(dest.Protocol, probe.Trace) {
+			u.traced = append(u.traced, dest.Name)
+		}
+	}
+
+	u.destinations = destinations
+	u.groups = config.Current().Groups
+	u.nameMap = make(map[string]int)
+	for idx, dest := range destinations {
+		row, ok := u.statRows[dest.Name]
+		if !ok {
+			// Create an empty stats row for initialisation
+			row = StatRow{stats: &probe.Result{Addr: dest.Address}}
+		}
+		row.dest = dest
+		// The schedule of the destination may have changed along with it
+		row.next = u.nextRun(dest)
+		row.columns = u.columns
+		u.statRows[dest.Name] = row
+		u.nameMap[dest.Name] = idx
+	}
+
+	// Forget the destinations which have been removed
+	for name := range u.statRows {
+		if _, ok := u.nameMap[name]; !ok {
+			delete(u.statRows, name)
+		}
+	}
+	for name := range u.hops {
+		if _, ok := u.nameMap[name]; !ok {
+			delete(u.hops, name)
+		}
+	}
+	u.build()
+}
+
+// setStats updates the row of the destination with its latest stats
+func (u *EkkoUI) setStats(dest config.Server, stats *probe.Result, err string) {
+	if _, ok := u.nameMap[dest.Name]; !ok {
+		// The destination has been removed while it was being pinged
+		return
+	}
+	row := StatRow{dest: dest, stats: stats, err: err, columns: u.columns, recorded: time.Now(), next: u.nextRun(dest)}
+	u.statRows[dest.Name] = row
+	if stats != nil && stats.Hops != nil {
+		u.hops[dest.Name] = stats.Hops
+	}
+	// The aggregate stats of the group of the destination change along with its row
+	u.build()
+}
+
+// nextRun returns the time the destination is due at next, zero when it isn't scheduled
+func (u *EkkoUI) nextRun(dest config.Server) time.Time {
+	if !dest.Scheduled() || u.scheduler == nil {
+		return time.Time{}
+	}
+	next, _ := u.scheduler.NextRun(dest.Name)
+	return next
+}
+
+// build rebuilds the rows of the table, including the header. The destinations are shown under the header
+// row of their group when groups are configured, the rows of the collapsed groups being left out.
+func (u *EkkoUI) build() {
+	u.rows = [][]string{tableHeader(u.columns)}
+	if len(u.groups) == 0 {
+		for _, dest := range u.destinations {
+			u.rows = append(u.rows, u.statRows[dest.Name].build())
+		}
+		return
+	}
+	for _, s := range sections(u.groups, u.destinations, u.statRows) {
+		u.rows = append(u.rows, s.build(u.columns))
+		if s.group.Collapsed {
+			continue
+		}
+		for _, row := range s.rows {
+			u.rows = append(u.rows, row.build())
+		}
+	}
+}
@@ -0,0 +1,34 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"github.com/soheltarir/ekko/config"
+	"github.com/spf13/cobra"
+	"io"
+)
+
+// validate loads the configuration, reporting every problem found in it. The srv & dns generators aren't
+// resolved, as their lookups may be slow, or fail from where the configuration is validated.
+func validate(cmd *cobra.Command, args []string) error {
+	config.SkipDiscovery()
+	if err := config.Load(); err != nil {
+		return err
+	}
+	fmt.Printf("%s is valid, %d server(s) configured\n", config.File(), len(config.Current().Servers))
+	return nil
+}
+
+// reportError prints the error a command failed with, listing every problem on its own line
+// when the configuration is invalid
+func reportError(w io.Writer, err error) {
+	var invalid config.ValidationError
+	if !errors.As(err, &invalid) {
+		fmt.Fprintf(w, "Error: %s\n", err)
+		return
+	}
+	fmt.Fprintf(w, "%s: %d problem(s) found\n", config.File(), len(invalid))
+	for _, problem := range invalid {
+		fmt.Fprintf(w, "  - %s\n", problem)
+	}
+}